@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var (
+	//ErrAckTimeout is passed to the ack of a Timeout emit which the server
+	//does not answer in time.
+	ErrAckTimeout = errors.New("ack timed out")
+	//ErrDisconnected is passed to the acks pending when the namespace is
+	//disconnected, the server never answers them.
+	ErrDisconnected = errors.New("disconnected before the ack")
+
+	errAckNeedsError = errors.New("ack of a Timeout emit must take error first")
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+//pendingAck is an ack waiting for the server. An ack taking error first is
+//called exactly once, with the error if the emit fails or is never
+//answered, other acks are dropped then. An ack of EmitWithAck has reply
+//instead of caller, which is always called once.
+type pendingAck struct {
+	caller   *caller
+	errFirst bool
+	reply    func(Ack, error)
+	timer    *time.Timer
+}
+
+func newPendingAck(c *caller) *pendingAck {
+	return &pendingAck{
+		caller:   c,
+		errFirst: len(c.Args) > 0 && c.Args[0] == errorType,
+	}
+}
+
+//fail calls the ack with err, if it takes error first.
+func (a *pendingAck) fail(err error) {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.reply != nil {
+		a.reply(Ack{}, err)
+		return
+	}
+	if !a.errFirst {
+		return
+	}
+	args := a.caller.GetArgs()
+	*args[0].(*error) = err
+	a.caller.Call(args)
+}
+
+//Ack is the answer of the server to EmitWithAck.
+type Ack struct {
+	args   []json.RawMessage
+	binary [][]byte
+}
+
+//Len returns the number of arguments of the ack.
+func (a Ack) Len() int {
+	return len(a.args)
+}
+
+//Decode decodes the arguments of the ack into the pointers of v in order.
+//Arguments without pointers are skipped, pointers without arguments are
+//left untouched.
+func (a Ack) Decode(v ...interface{}) error {
+	for i := 0; i < len(v) && i < len(a.args); i++ {
+		if err := json.Unmarshal(a.args[i], v[i]); err != nil {
+			return err
+		}
+		if len(a.binary) > 0 {
+			if err := decodeAttachments(v[i], a.binary); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type ackReply struct {
+	ack Ack
+	err error
+}
+
+//EmitWithAck sends the message and blocks until the server acks it. It
+//returns ErrDisconnected if the namespace is disconnected first, and
+//ctx.Err() if ctx is done first. The handlers of On run on the goroutine
+//reading the acks, call it from another goroutine there. Decode the ack with
+//Ack.Decode:
+//
+//	ack, err := s.EmitWithAck(ctx, "add", 1, 2)
+//	var sum int
+//	err = ack.Decode(&sum)
+func (client *Socket) EmitWithAck(ctx context.Context, method string, args ...interface{}) (Ack, error) {
+	return client.emitWithAck(ctx, defaultFlags, method, args)
+}
+
+func (client *Socket) emitWithAck(ctx context.Context, flags emitFlags, method string, args []interface{}) (Ack, error) {
+	if !client.beginWrite() {
+		return Ack{}, ErrClosed
+	}
+	replied := make(chan ackReply, 1)
+	ack := &pendingAck{
+		reply: func(a Ack, err error) {
+			replied <- ackReply{a, err}
+		},
+	}
+	args = append([]interface{}{method}, args...)
+	id, err := client.sendID(ctx, flags, args, ack)
+	if err != nil {
+		return Ack{}, err
+	}
+	select {
+	case r := <-replied:
+		return r.ack, r.err
+	case <-ctx.Done():
+		client.failAck(id, ctx.Err())
+		r := <-replied //answered or failed, whichever is first
+		return r.ack, r.err
+	}
+}
+
+//Timeout returns an Emitter whose acks get ErrAckTimeout if the server does
+//not answer within d. The acks must take error first:
+//
+//	s.Timeout(time.Second).Emit("query", func(err error, r string) {})
+func (client *Socket) Timeout(d time.Duration) *Emitter {
+	return newEmitter(client).Timeout(d)
+}
+
+//takeAck removes the pending ack of id.
+func (client *Socket) takeAck(id int) (*pendingAck, bool) {
+	client.acksLock.Lock()
+	a, ok := client.acks[id]
+	delete(client.acks, id)
+	client.acksLock.Unlock()
+	if ok {
+		client.notifyIdle()
+	}
+	return a, ok
+}
+
+//failAck fails the pending ack of id with err, unless it is answered
+//already.
+func (client *Socket) failAck(id int, err error) {
+	if a, ok := client.takeAck(id); ok {
+		a.fail(err)
+	}
+}
+
+//failAcks fails the pending acks with err in the order of their ids, except
+//the acks of the packets in keep, which are not sent yet.
+func (client *Socket) failAcks(err error, keep map[int]bool) {
+	client.acksLock.Lock()
+	ids := make([]int, 0, len(client.acks))
+	for id := range client.acks {
+		if !keep[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	failed := make([]*pendingAck, len(ids))
+	for i, id := range ids {
+		failed[i] = client.acks[id]
+		delete(client.acks, id)
+	}
+	client.acksLock.Unlock()
+	client.notifyIdle()
+	for _, a := range failed {
+		a.fail(err)
+	}
+}
@@ -130,6 +130,11 @@ func decodeAttachmentValue(v reflect.Value, binary [][]byte) error {
 		if err := decodeAttachmentValue(reflect.ValueOf(v.Interface()), binary); err != nil {
 			return err
 		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return decodeAttachmentValue(v.Elem(), binary)
 	}
 	return nil
 }
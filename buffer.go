@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//defaultSendBufferSize is the default size of the buffer of emits made while
+//disconnected.
+const defaultSendBufferSize = 100
+
+var (
+	//ErrBufferFull is returned by Emit when the socket is disconnected and
+	//the send buffer is full.
+	ErrBufferFull = errors.New("send buffer is full")
+	//ErrExpired is the error of a message buffered longer than SendBufferTTL,
+	//its ack gets it if the ack takes error first.
+	ErrExpired = errors.New("message expired in the send buffer")
+)
+
+//bufferedPacket is a packet emitted while disconnected.
+type bufferedPacket struct {
+	ctx     context.Context
+	flags   emitFlags
+	packet  packet
+	done    func(error)
+	created time.Time
+}
+
+func (client *Socket) sendBufferSize() int {
+	if client.options.SendBufferSize == 0 {
+		return defaultSendBufferSize
+	}
+	return client.options.SendBufferSize
+}
+
+func (client *Socket) expired(p *bufferedPacket, now time.Time) bool {
+	ttl := client.options.SendBufferTTL
+	return ttl > 0 && now.Sub(p.created) > ttl
+}
+
+//bufferPacket keeps the packet until the namespace is connected. It returns
+//false if the socket is connected, and the packet should be sent now.
+func (client *Socket) bufferPacket(ctx context.Context, flags emitFlags, p packet, done func(error)) (bool, error) {
+	client.bufferLock.Lock()
+	if client.connected {
+		client.bufferLock.Unlock()
+		return false, nil
+	}
+	if flags.volatile {
+		client.bufferLock.Unlock()
+		return true, ErrDropped
+	}
+	var expired []*bufferedPacket
+	if len(client.buffered) >= client.sendBufferSize() {
+		now := time.Now()
+		kept := client.buffered[:0]
+		for _, b := range client.buffered {
+			if client.expired(b, now) {
+				expired = append(expired, b)
+			} else {
+				kept = append(kept, b)
+			}
+		}
+		client.buffered = kept
+	}
+	var err error
+	if len(client.buffered) < client.sendBufferSize() {
+		client.buffered = append(client.buffered, &bufferedPacket{
+			ctx:     ctx,
+			flags:   flags,
+			packet:  p,
+			done:    done,
+			created: time.Now(),
+		})
+	} else {
+		err = ErrBufferFull
+	}
+	client.bufferLock.Unlock()
+	for _, b := range expired {
+		b.done(ErrExpired)
+	}
+	return true, err
+}
+
+//flushBuffer sends the buffered packets in order once the namespace is
+//connected. Emits made while flushing are buffered too, so they keep their
+//order.
+func (client *Socket) flushBuffer() {
+	for {
+		client.bufferLock.Lock()
+		buffered := client.buffered
+		client.buffered = nil
+		if len(buffered) == 0 {
+			client.connected = true
+			client.bufferLock.Unlock()
+			return
+		}
+		client.bufferLock.Unlock()
+		now := time.Now()
+		for _, b := range buffered {
+			if client.expired(b, now) {
+				b.done(ErrExpired)
+				continue
+			}
+			client.sendConnected(b.ctx, b.flags, b.packet, b.done)
+		}
+	}
+}
+
+//setDisconnected makes the emits buffered until the namespace is connected
+//again. It returns whether the namespace was connected.
+func (client *Socket) setDisconnected() bool {
+	client.bufferLock.Lock()
+	defer client.bufferLock.Unlock()
+	connected := client.connected
+	client.connected = false
+	return connected
+}
+
+//bufferedAcks returns the ack ids of the buffered packets.
+func (client *Socket) bufferedAcks() map[int]bool {
+	client.bufferLock.Lock()
+	defer client.bufferLock.Unlock()
+	ids := make(map[int]bool)
+	for _, b := range client.buffered {
+		if b.packet.Id >= 0 {
+			ids[b.packet.Id] = true
+		}
+	}
+	return ids
+}
+
+func (client *Socket) isConnected() bool {
+	client.bufferLock.Lock()
+	defer client.bufferLock.Unlock()
+	return client.connected
+}
+
+//clearBuffer removes the buffered packets, failing them with err, and
+//returns how many were removed.
+func (client *Socket) clearBuffer(err error) int {
+	client.bufferLock.Lock()
+	buffered := client.buffered
+	client.buffered = nil
+	client.bufferLock.Unlock()
+	for _, b := range buffered {
+		b.done(err)
+	}
+	return len(buffered)
+}
@@ -7,6 +7,15 @@ import (
 	"sync"
 )
 
+//handler is the handler of an event.
+type handler interface {
+	//call decodes the arguments of packet and calls the handler, it returns
+	//the arguments of the ack.
+	call(decoder *decoder, packet *packet) ([]interface{}, error)
+	//fire calls the handler of a local event with args.
+	fire(args []interface{})
+}
+
 type caller struct {
 	sync.RWMutex
 	Func reflect.Value
@@ -71,3 +80,49 @@ func (c *caller) Call(args []interface{}) []reflect.Value {
 	}
 	return c.Func.Call(a)
 }
+
+func (c *caller) call(decoder *decoder, packet *packet) ([]interface{}, error) {
+	args := c.GetArgs()
+	olen := len(args)
+	if olen > 0 {
+		packet.Data = &args
+		if err := decoder.DecodeData(packet); err != nil {
+			return nil, err
+		}
+	}
+	for i := len(args); i < olen; i++ {
+		args = append(args, nil)
+	}
+
+	retV := c.Call(args)
+	if len(retV) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	if last, ok := retV[len(retV)-1].Interface().(error); ok {
+		err = last
+		retV = retV[0 : len(retV)-1]
+	}
+	ret := make([]interface{}, len(retV))
+	for i, v := range retV {
+		ret[i] = v.Interface()
+	}
+	return ret, err
+}
+
+func (c *caller) fire(args []interface{}) {
+	values := c.GetArgs()
+	for i := 0; i < len(values) && i < len(args); i++ {
+		v := reflect.ValueOf(args[i])
+		if v.IsValid() && v.Type() == reflect.TypeOf(values[i]) { //pointer arguments
+			values[i] = args[i]
+			continue
+		}
+		e := reflect.ValueOf(values[i]).Elem()
+		if v.IsValid() && v.Type().ConvertibleTo(e.Type()) {
+			e.Set(v.Convert(e.Type()))
+		}
+	}
+	c.Call(values)
+}
@@ -8,7 +8,7 @@ import (
 
 func TestClientConnect(t *testing.T) {
 	Convey("Connect", t, func() {
-		conn, err := Connect("http://localhost:3000")
+		conn, err := Connect("http://localhost:3000", nil)
 		So(err, ShouldBeNil)
 		So(conn, ShouldNotBeNil)
 	})
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+//ErrClosed is returned when emitting on a closed socket.
+var ErrClosed = errors.New("socket is closed")
+
+//CloseSummary reports what Close abandoned when ctx is done.
+type CloseSummary struct {
+	PendingWrites    int   //emits still being written
+	PendingAcks      []int //ids of the acks never answered
+	DisconnectUnsent bool  //DISCONNECT is not sent to the server
+}
+
+//Close stops accepting emits, waits for the emits being written and the
+//pending acks until ctx is done, then sends DISCONNECT and leaves the
+//namespace. The connection is closed with the last namespace. Nothing is
+//sent once ctx is done, the connection is torn down instead. It returns
+//ctx.Err() if something is abandoned.
+func (client *Socket) Close(ctx context.Context) (CloseSummary, error) {
+	client.closeLock.Lock()
+	if client.closing {
+		client.closeLock.Unlock()
+		return CloseSummary{}, ErrClosed
+	}
+	client.closing = true
+	client.closeLock.Unlock()
+	var summary CloseSummary
+	if !client.isConnected() { //nothing to wait for until reconnected
+		summary.PendingWrites = client.clearBuffer(ErrClosed)
+	}
+	conn := client.getConn()
+
+	var err error
+	for conn != nil {
+		writes, acks := client.pending()
+		if writes == 0 && len(acks) == 0 {
+			break
+		}
+		select {
+		case <-client.idle:
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		summary.PendingWrites += writes
+		summary.PendingAcks = acks
+		break
+	}
+	if client.queue != nil {
+		close(client.stopWriting)
+		client.queue.clear(ErrClosed)
+	}
+	client.failAcks(ErrClosed, nil)
+
+	if conn != nil {
+		p := packet{
+			Type: _DISCONNECT,
+			Id:   -1,
+			NSP:  client.namespace,
+		}
+		if werr := client.writePacket(ctx, defaultFlags, p); werr != nil {
+			summary.DisconnectUnsent = true
+			if err == nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+		}
+	}
+	if cerr := client.manager.remove(ctx, client); err == nil {
+		err = cerr
+	}
+	client.onDisconnect(ReasonClientClose, nil)
+	return summary, err
+}
+
+//pending returns the number of emits being written and the ids of the
+//pending acks.
+func (client *Socket) pending() (int, []int) {
+	client.closeLock.Lock()
+	writes := client.writing
+	client.closeLock.Unlock()
+	client.acksLock.Lock()
+	acks := make([]int, 0, len(client.acks))
+	for id := range client.acks {
+		acks = append(acks, id)
+	}
+	client.acksLock.Unlock()
+	sort.Ints(acks)
+	return writes, acks
+}
+
+func (client *Socket) isClosing() bool {
+	client.closeLock.Lock()
+	defer client.closeLock.Unlock()
+	return client.closing
+}
+
+//beginWrite counts an emit being written, it returns false if the socket is
+//closed.
+func (client *Socket) beginWrite() bool {
+	client.closeLock.Lock()
+	defer client.closeLock.Unlock()
+	if client.closing {
+		return false
+	}
+	client.writing++
+	return true
+}
+
+func (client *Socket) endWrite() {
+	client.closeLock.Lock()
+	client.writing--
+	client.closeLock.Unlock()
+	client.notifyIdle()
+}
+
+//notifyIdle wakes up Close to check the pending writes and acks.
+func (client *Socket) notifyIdle() {
+	signal(client.idle)
+}
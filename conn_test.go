@@ -0,0 +1,97 @@
+package client
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnHandshakeRequest(t *testing.T) {
+	Convey("Handshake with custom headers, query, path and cookies", t, func() {
+		requests := make(chan *http.Request, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+			header := http.Header{}
+			header.Set("Set-Cookie", "affinity=node1; Path=/")
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, header)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+
+		jar, err := cookiejar.New(nil)
+		So(err, ShouldBeNil)
+		options := &SocketOption{
+			Header: http.Header{"Authorization": {"Bearer token"}},
+			Query:  url.Values{"room": {"a"}},
+			Path:   "/realtime/",
+			Jar:    jar,
+
+			ForceBase64: true,
+		}
+		u, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		for i := 0; i < 2; i++ {
+			c, err := newConn(u, options, nil)
+			So(err, ShouldBeNil)
+			c.Close()
+		}
+		first, second := <-requests, <-requests
+		So(first.URL.Path, ShouldEqual, "/realtime/")
+		So(first.URL.Query().Get("room"), ShouldEqual, "a")
+		So(first.URL.Query().Get("EIO"), ShouldEqual, "3")
+		So(first.URL.Query().Get("b64"), ShouldEqual, "1")
+		So(first.Header.Get("Authorization"), ShouldEqual, "Bearer token")
+		So(first.Header.Get("Cookie"), ShouldEqual, "")
+		So(second.Header.Get("Cookie"), ShouldEqual, "affinity=node1")
+	})
+}
+
+func TestConnPath(t *testing.T) {
+	Convey("Append socket.io/ to the path of the url", t, func() {
+		for rawurl, expect := range map[string]string{
+			"http://localhost":                          "http://localhost/socket.io/",
+			"http://localhost/":                         "http://localhost/socket.io/",
+			"http://localhost/app":                      "http://localhost/app/socket.io/",
+			"http://localhost/socket.io/?room=a":        "http://localhost/socket.io/?room=a",
+			"unix:///run/app.sock":                      "unix:///run/app.sock:/socket.io/",
+			"unix:///run/app.sock:/realtime/":           "unix:///run/app.sock:/realtime/socket.io/",
+			"unix:///run/app.sock:/realtime/socket.io/": "unix:///run/app.sock:/realtime/socket.io/",
+		} {
+			u, err := url.Parse(rawurl)
+			So(err, ShouldBeNil)
+			So(withSocketioPath(u), ShouldEqual, expect)
+		}
+	})
+
+	Convey("Handshake at /socket.io/ without the Path option", t, func() {
+		paths := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+
+		u, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		c, err := newConn(u, &SocketOption{}, nil)
+		So(err, ShouldBeNil)
+		c.Close()
+		So(<-paths, ShouldEqual, "/socket.io/")
+	})
+}
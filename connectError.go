@@ -0,0 +1,49 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//ConnectError is the error of a namespace which the server refuses to
+//connect, such as by a middleware rejecting the auth. It is passed to the
+//handler of OnConnectError:
+//
+//	s.On(OnConnectError, func(err *ConnectError) {})
+type ConnectError struct {
+	Namespace string
+	Message   string
+	Data      json.RawMessage //data of the error, null if the server sent none
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connect to namespace %s: %s", namespaceName(e.Namespace), e.Message)
+}
+
+//decodeConnectError decodes the data of an ERROR packet, which is
+//{"message":..,"data":..} from socket.io v3 and v4 servers, and a string from
+//socket.io v2 servers.
+func decodeConnectError(nsp string, raw json.RawMessage) *ConnectError {
+	e := &ConnectError{
+		Namespace: nsp,
+		Data:      json.RawMessage("null"),
+	}
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		e.Message = message
+		return e
+	}
+	var v struct {
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		e.Message = string(raw)
+		return e
+	}
+	e.Message = v.Message
+	if len(v.Data) > 0 {
+		e.Data = v.Data
+	}
+	return e
+}
@@ -134,9 +134,12 @@ func (d *decoder) Decode(v *packet) error {
 		return nil
 	}
 	switch v.Type {
+	case _CONNECT, _ERROR:
+		d.current = reader
+		d.currentCloser = r
 	case _EVENT:
 		fallthrough
-	case _BINARY_EVENT, _CONNECT:
+	case _BINARY_EVENT:
 		msgReader, err := newMessageReader(reader)
 		if err != nil {
 			return err
@@ -181,6 +184,32 @@ func (d *decoder) DecodeData(v *packet) error {
 	return nil
 }
 
+//DecodeRaw decodes the data of packet v to raw json arguments, with its
+//binary attachments, instead of binding them to values.
+func (d *decoder) DecodeRaw(v *packet) ([]json.RawMessage, [][]byte, error) {
+	if d.current == nil {
+		return nil, nil, nil
+	}
+	defer func() {
+		d.Close()
+	}()
+	var args []json.RawMessage
+	decoder := json.NewDecoder(d.current)
+	if err := decoder.Decode(&args); err != nil {
+		return nil, nil, err
+	}
+	var binary [][]byte
+	if v.Type == _BINARY_EVENT || v.Type == _BINARY_ACK {
+		var err error
+		binary, err = d.decodeBinary(v.attachNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		v.Type -= _BINARY_EVENT - _EVENT
+	}
+	return args, binary, nil
+}
+
 func (d *decoder) decodeBinary(num int) ([][]byte, error) {
 	ret := make([][]byte, num)
 	for i := 0; i < num; i++ {
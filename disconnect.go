@@ -0,0 +1,53 @@
+package client
+
+import "github.com/webrtcn/go-socketio-client/engineio"
+
+//DisconnectReason tells why the connection is lost, it is passed to the
+//handler of OnDisConnection with the underlying error:
+//
+//	s.On(OnDisConnection, func(reason DisconnectReason, err error) {})
+type DisconnectReason int
+
+//Disconnect reasons
+const (
+	ReasonUnknown          DisconnectReason = iota
+	ReasonServerDisconnect                  //the server sent socket.io DISCONNECT
+	ReasonClientClose                       //Close is called
+	ReasonPingTimeout                       //no heartbeat in time
+	ReasonTransportClose                    //the server sent engine.io CLOSE
+	ReasonTransportError                    //reading or writing the transport failed
+	ReasonParseError                        //the server sent an invalid packet
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case ReasonServerDisconnect:
+		return "io server disconnect"
+	case ReasonClientClose:
+		return "io client disconnect"
+	case ReasonPingTimeout:
+		return "ping timeout"
+	case ReasonTransportClose:
+		return "transport close"
+	case ReasonTransportError:
+		return "transport error"
+	case ReasonParseError:
+		return "parse error"
+	}
+	return "unknown"
+}
+
+//disconnectReason returns the reason of a closed engine.io session.
+func disconnectReason(r engineio.CloseReason) DisconnectReason {
+	switch r {
+	case engineio.ReasonClientClose:
+		return ReasonClientClose
+	case engineio.ReasonPingTimeout:
+		return ReasonPingTimeout
+	case engineio.ReasonTransportClose:
+		return ReasonTransportClose
+	case engineio.ReasonTransportError:
+		return ReasonTransportError
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+type emitFlags struct {
+	compress bool
+	volatile bool
+	timeout  time.Duration
+}
+
+var defaultFlags = emitFlags{
+	compress: true,
+}
+
+//Emitter sends messages with the flags set by its methods, such as
+//socket.Compress(false).Emit("event", data).
+type Emitter struct {
+	socket *Socket
+	flags  emitFlags
+}
+
+func newEmitter(socket *Socket) *Emitter {
+	return &Emitter{
+		socket: socket,
+		flags:  defaultFlags,
+	}
+}
+
+//Compress sets whether the message is compressed, when compression is enabled.
+func (e *Emitter) Compress(compress bool) *Emitter {
+	e.flags.compress = compress
+	return e
+}
+
+//Volatile makes the message dropped, instead of buffered or waiting, when
+//the socket is not connected or the connection is busy.
+func (e *Emitter) Volatile() *Emitter {
+	e.flags.volatile = true
+	return e
+}
+
+//Timeout makes the ack get ErrAckTimeout if the server does not answer
+//within d. The ack must take error first.
+func (e *Emitter) Timeout(d time.Duration) *Emitter {
+	e.flags.timeout = d
+	return e
+}
+
+//Emit send message to server
+func (e *Emitter) Emit(method string, args ...interface{}) error {
+	return e.socket.emit(context.Background(), e.flags, method, args)
+}
+
+//EmitContext is Emit whose write is canceled when ctx is done.
+func (e *Emitter) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	return e.socket.emit(ctx, e.flags, method, args)
+}
+
+//EmitWithAck sends the message and blocks until the server acks it.
+func (e *Emitter) EmitWithAck(ctx context.Context, method string, args ...interface{}) (Ack, error) {
+	return e.socket.emitWithAck(ctx, e.flags, method, args)
+}
@@ -1,4 +1,4 @@
-package client
+package engineio
 
 import (
 	"github.com/webrtcn/go-socketio-client/parser"
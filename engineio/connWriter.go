@@ -1,4 +1,4 @@
-package client
+package engineio
 
 import (
 	"io"
@@ -7,10 +7,10 @@ import (
 
 type connWriter struct {
 	io.WriteCloser
-	locker *sync.Mutex
+	locker sync.Locker
 }
 
-func newConnWriter(w io.WriteCloser, locker *sync.Mutex) *connWriter {
+func newConnWriter(w io.WriteCloser, locker sync.Locker) *connWriter {
 	return &connWriter{
 		WriteCloser: w,
 		locker:      locker,
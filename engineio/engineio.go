@@ -0,0 +1,120 @@
+//Package engineio is the client of engine.io sessions, without socket.io on
+//top. It does the handshake, the heartbeat and the upgrade of transports, and
+//sends and receives the messages.
+package engineio
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+//Protocol versions of engine.io
+const (
+	ProtocolV3 = 3
+	ProtocolV4 = 4
+)
+
+//ErrBusy is returned by Write with NoWait when another message is being
+//written.
+var ErrBusy = errors.New("engineio: session is busy")
+
+//Options of a session.
+type Options struct {
+	ProtocolVersion int  // ProtocolV3 or ProtocolV4. default value ProtocolV3.
+	Upgrade         bool // connect with the first transport, then upgrade to the others when the server allows.
+	// Transports is the names of registered transports, tried in order until one connects.
+	// default value {"websocket"}, or {"polling", "websocket"} when Upgrade is set.
+	Transports  []string
+	Header      http.Header // extra headers of handshake requests.
+	Query       url.Values  // extra query parameters of handshake requests.
+	ForceBase64 bool        // send binary messages as base64 text.
+	// WriteTimeout is the time limit of writing each packet, including PING, PONG and CLOSE.
+	// Control packets are limited by the pingTimeout of the server if 0, messages are not.
+	WriteTimeout time.Duration
+	// Transport is passed to the transports, such as TLS config, proxy, path and compression.
+	Transport transport.Options
+	// OnHeartbeat is called when a PING is sent or received, and when a PONG answers the PING
+	// of the client with the round trip time.
+	OnHeartbeat func(t parser.PacketType, rtt time.Duration)
+}
+
+func (o *Options) protocolVersion() int {
+	if o.ProtocolVersion == ProtocolV4 {
+		return ProtocolV4
+	}
+	return ProtocolV3
+}
+
+func (o *Options) transports() []string {
+	if len(o.Transports) > 0 {
+		return o.Transports
+	}
+	if o.Upgrade {
+		return []string{"polling", "websocket"}
+	}
+	return []string{"websocket"}
+}
+
+//Handshake is the handshake sent by the server in OPEN packet.
+type Handshake struct {
+	SessionID    string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int      `json:"pingInterval"` // milliseconds
+	PingTimeout  int      `json:"pingTimeout"`  // milliseconds
+	MaxPayload   int      `json:"maxPayload"`   // bytes, 0 if the server has no limit
+}
+
+//PayloadTooLargeError is returned when a message is larger than the
+//maxPayload of the server. The message is not sent.
+type PayloadTooLargeError struct {
+	Size       int
+	MaxPayload int
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("payload of %d bytes exceeds max payload %d", e.Size, e.MaxPayload)
+}
+
+//CloseReason tells why a session is closed.
+type CloseReason int
+
+//Close reasons
+const (
+	ReasonUnknown        CloseReason = iota
+	ReasonClientClose                //Close is called
+	ReasonPingTimeout                //no heartbeat in time
+	ReasonTransportClose             //the server sent CLOSE
+	ReasonTransportError             //reading or writing the transport failed
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case ReasonClientClose:
+		return "client close"
+	case ReasonPingTimeout:
+		return "ping timeout"
+	case ReasonTransportClose:
+		return "transport close"
+	case ReasonTransportError:
+		return "transport error"
+	}
+	return "unknown"
+}
+
+//Message is a MESSAGE packet.
+type Message struct {
+	Type parser.MessageType
+	Data []byte
+}
+
+//WriteFlags changes how Write writes the messages.
+type WriteFlags struct {
+	NoCompress bool // do not compress the messages, when compression is enabled.
+	NoWait     bool // return ErrBusy instead of waiting for another message being written.
+}
@@ -0,0 +1,777 @@
+package engineio
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+
+	//register the default transports
+	_ "github.com/webrtcn/go-socketio-client/polling"
+	_ "github.com/webrtcn/go-socketio-client/websocket"
+)
+
+const probeData = "probe"
+
+//defaultPingTimeout is used until the handshake tells the pingTimeout.
+const defaultPingTimeout = 10 * time.Second
+
+var errProbeFailed = errors.New("upgrade probe failed")
+
+type state int
+
+const (
+	stateUnknow state = iota
+	stateNormal
+	stateClosing
+	stateClosed
+)
+
+//Session is an engine.io session. A closed session is never reconnected, dial
+//a new one instead.
+type Session struct {
+	url             *url.URL
+	request         *http.Request
+	writerLocker    writeLock
+	transportLocker sync.RWMutex
+	currentName     string
+	current         transport.Client
+	state           state
+	stateLocker     sync.RWMutex
+	reason          CloseReason
+	reasonErr       error
+	readerChan      chan *connReader
+	handshake       Handshake
+	handshakeLocker sync.RWMutex
+	pingTimeout     time.Duration
+	pingInterval    time.Duration
+	pingChan        chan bool
+	pingDone        chan struct{} //closed when pingLoop returns
+	rtt             int64         //nanoseconds, accessed atomically
+	pausedChan      chan struct{}
+	options         Options
+	unixSocket      string
+	cancel          context.CancelFunc
+}
+
+//Dial connects to the engine.io server of rawurl, like
+//http://example.com/engine.io/ or unix:///run/app.sock:/realtime/. The path
+//is used as it is. ctx bounds the handshake only. opts can be nil.
+func Dial(ctx context.Context, rawurl string, opts *Options) (*Session, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	session := &Session{
+		url:          u,
+		writerLocker: newWriteLock(),
+		state:        stateNormal,
+		pingTimeout:  defaultPingTimeout,
+		pingInterval: 5 * time.Second,
+		pingChan:     make(chan bool),
+		pingDone:     make(chan struct{}),
+		pausedChan:   make(chan struct{}, 1),
+		readerChan:   make(chan *connReader),
+		options:      *opts,
+	}
+	if u.Scheme == unixScheme {
+		session.url, session.unixSocket = splitUnixURL(u)
+	}
+	//the transports keep the context of the request, which lives as long as
+	//the session
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	session.cancel = cancel
+	dialed := make(chan struct{})
+	defer close(dialed)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-dialed:
+		}
+	}()
+	if err := session.open(sessionCtx); err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	go session.readLoop()
+	return session, nil
+}
+
+//ID returns the session id.
+func (s *Session) ID() string {
+	return s.getHandshake().SessionID
+}
+
+//Handshake returns the handshake of the server.
+func (s *Session) Handshake() Handshake {
+	return s.getHandshake()
+}
+
+//Transport returns the name of the transport in use.
+func (s *Session) Transport() string {
+	s.transportLocker.RLock()
+	defer s.transportLocker.RUnlock()
+	return s.currentName
+}
+
+//Request returns the handshake request.
+func (s *Session) Request() *http.Request {
+	return s.request
+}
+
+//Send writes a message.
+func (s *Session) Send(t parser.MessageType, data []byte) error {
+	return s.Write(context.Background(), []Message{{Type: t, Data: data}}, WriteFlags{})
+}
+
+//Receive reads the next message.
+func (s *Session) Receive() (parser.MessageType, []byte, error) {
+	t, r, err := s.NextReader()
+	if err != nil {
+		return t, nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	return t, b, err
+}
+
+//NextReader returns the reader of the next message.
+func (s *Session) NextReader() (parser.MessageType, io.ReadCloser, error) {
+	if s.getState() == stateClosed {
+		return parser.MessageBinary, nil, io.EOF
+	}
+	ret := <-s.readerChan
+	if ret == nil {
+		return parser.MessageBinary, nil, io.EOF
+	}
+	return parser.MessageType(ret.MessageType()), ret, nil
+}
+
+//NextWriter returns the writer of a message, no other message is written
+//until it is closed.
+func (s *Session) NextWriter(t parser.MessageType) (io.WriteCloser, error) {
+	switch s.getState() {
+	case stateNormal:
+	default:
+		return nil, io.EOF
+	}
+	s.writerLocker.Lock()
+	ret, err := s.messageWriter(t, true)
+	if err != nil {
+		s.writerLocker.Unlock()
+		return ret, err
+	}
+	writer := newConnWriter(ret, s.writerLocker)
+	return writer, err
+}
+
+//Write writes the messages together, such as a socket.io packet and its
+//attachments. Nothing is written if any message is larger than the
+//maxPayload of the server, or ctx is done before the writer is free. If ctx
+//is done while writing, the session is closed, because a half-written
+//message can not be taken back.
+func (s *Session) Write(ctx context.Context, msgs []Message, flags WriteFlags) error {
+	if err := s.CheckPayload(msgs); err != nil {
+		return err
+	}
+	switch s.getState() {
+	case stateNormal:
+	default:
+		return io.EOF
+	}
+	if timeout := s.options.WriteTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if flags.NoWait {
+		if !s.writerLocker.TryLock() {
+			return ErrBusy
+		}
+	} else if err := s.writerLocker.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.writerLocker.Unlock()
+	stop := s.watchWrite(ctx)
+	err := s.writeLocked(msgs, !flags.NoCompress)
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+//CheckPayload returns PayloadTooLargeError if any message is larger than the
+//maxPayload of the server, as it is encoded by the transport in use.
+func (s *Session) CheckPayload(msgs []Message) error {
+	max := s.getHandshake().MaxPayload
+	if max <= 0 {
+		return nil
+	}
+	for _, m := range msgs {
+		if size := s.payloadSize(m); size > max {
+			return &PayloadTooLargeError{
+				Size:       size,
+				MaxPayload: max,
+			}
+		}
+	}
+	return nil
+}
+
+//payloadSize returns the size of the packet of m. Binary messages are sent as
+//base64 text with ForceBase64, and always over engine.io v4 polling.
+func (s *Session) payloadSize(m Message) int {
+	if m.Type != parser.MessageBinary {
+		return len(m.Data) + 1 //with packet type
+	}
+	v4 := s.options.protocolVersion() >= ProtocolV4
+	switch {
+	case v4 && (s.options.ForceBase64 || s.Transport() == "polling"):
+		return len("b") + base64.StdEncoding.EncodedLen(len(m.Data))
+	case s.options.ForceBase64:
+		return len("b4") + base64.StdEncoding.EncodedLen(len(m.Data))
+	case v4: //binary frame without packet type
+		return len(m.Data)
+	}
+	return len(m.Data) + 1
+}
+
+func (s *Session) writeLocked(msgs []Message, compress bool) error {
+	for _, m := range msgs {
+		w, err := s.messageWriter(m.Type, compress)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(m.Data); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//watchWrite closes the transport if ctx is done before stop is called, which
+//unblocks the write. A half-written packet can not be taken back, so the
+//connection is lost. stop returns false if the transport is closed.
+func (s *Session) watchWrite(ctx context.Context) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return true }
+	}
+	var locker sync.Mutex
+	finished, aborted := false, false
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		locker.Lock()
+		defer locker.Unlock()
+		if finished {
+			return
+		}
+		aborted = true
+		s.setReason(ReasonTransportError, ctx.Err())
+		s.getCurrent().Close()
+	}()
+	return func() bool {
+		locker.Lock()
+		defer locker.Unlock()
+		finished = true
+		close(done)
+		return !aborted
+	}
+}
+
+//writeControl writes control packet t with data, which can be nil. Like
+//Write, it gives up when ctx is done before the writer is free, and closes
+//the transport when ctx is done while writing. The write is limited by
+//controlTimeout too, so a stalled peer never blocks it for good.
+func (s *Session) writeControl(ctx context.Context, t parser.PacketType, data io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, s.controlTimeout())
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.writerLocker.LockContext(ctx); err != nil {
+		return err
+	}
+	defer s.writerLocker.Unlock()
+	stop := s.watchWrite(ctx)
+	err := s.writeControlLocked(t, data)
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Session) writeControlLocked(t parser.PacketType, data io.Reader) error {
+	w, err := s.getCurrent().NextWriter(parser.MessageText, t)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		if _, err := io.Copy(w, data); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+//controlTimeout returns the time limit of writing control packets, which is
+//WriteTimeout, or the pingTimeout of the server when it is 0.
+func (s *Session) controlTimeout() time.Duration {
+	if s.options.WriteTimeout > 0 {
+		return s.options.WriteTimeout
+	}
+	if t := s.getHandshake().PingTimeout; t > 0 {
+		return time.Duration(t) * time.Millisecond
+	}
+	return defaultPingTimeout
+}
+
+//messageWriter returns the MESSAGE writer of current transport, writerLocker
+//must be held.
+func (s *Session) messageWriter(t parser.MessageType, compress bool) (io.WriteCloser, error) {
+	current := s.getCurrent()
+	if w, ok := current.(transport.CompressionWriter); ok && !compress {
+		return w.NextWriterCompress(t, parser.MESSAGE, false)
+	}
+	return current.NextWriter(t, parser.MESSAGE)
+}
+
+//Close sends CLOSE and closes the session.
+func (s *Session) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+//CloseContext is Close which gives up sending CLOSE when ctx is done, the
+//session is closed anyway.
+func (s *Session) CloseContext(ctx context.Context) error {
+	return s.closeWith(ctx, ReasonClientClose, nil)
+}
+
+//closeWith closes the session for reason, unless it is closed already. CLOSE
+//is not sent if ctx is done or the writer stalls.
+func (s *Session) closeWith(ctx context.Context, reason CloseReason, err error) error {
+	s.setReason(reason, err)
+	if s.getState() != stateNormal {
+		return nil
+	}
+	s.writeControl(ctx, parser.CLOSE, nil)
+	err = s.getCurrent().Close()
+	s.setState(stateClosing)
+	return err
+}
+
+func (s *Session) onPacket(r *parser.PacketDecoder) {
+	if state := s.getState(); state != stateNormal {
+		return
+	}
+	switch r.Type() {
+	case parser.OPEN:
+		var conninfo Handshake
+		b, _ := ioutil.ReadAll(r)
+		defer func() {
+			r.Close()
+		}()
+		err := json.Unmarshal(b, &conninfo)
+		if err != nil { //get first message error. disconnect
+			s.getCurrent().Close()
+			return
+		}
+		s.handshakeLocker.Lock()
+		s.handshake = conninfo
+		s.handshakeLocker.Unlock()
+		s.pingInterval = time.Duration(conninfo.PingInterval) * time.Millisecond
+		s.pingTimeout = time.Duration(conninfo.PingTimeout) * time.Millisecond
+		go s.pingLoop()
+		if creater, ok := s.upgradeCreater(conninfo.Upgrades); ok {
+			go s.upgrade(creater)
+		}
+	case parser.CLOSE:
+		s.setReason(ReasonTransportClose, nil)
+		s.getCurrent().Close()
+	case parser.PING:
+		s.writeControl(context.Background(), parser.PONG, r)
+		s.onHeartbeat(parser.PING, 0)
+		fallthrough
+	case parser.PONG:
+		//nobody reads pingChan once pingLoop closes the session
+		select {
+		case s.pingChan <- true:
+		case <-s.pingDone:
+		}
+	case parser.MESSAGE:
+		closeChan := make(chan struct{})
+		s.readerChan <- newConnReader(r, closeChan)
+		<-closeChan
+		close(closeChan)
+		r.Close()
+	}
+}
+
+func (s *Session) onClose(server transport.Client) {
+	t := s.getCurrent()
+	if server != t {
+		return
+	}
+	s.stateLocker.Lock()
+	if s.state == stateClosed {
+		s.stateLocker.Unlock()
+		return
+	}
+	s.state = stateClosed
+	s.stateLocker.Unlock()
+	t.Close()
+	s.cancel()
+	close(s.readerChan)
+	close(s.pingChan)
+}
+
+//onHeartbeat calls the heartbeat handler, if any.
+func (s *Session) onHeartbeat(t parser.PacketType, rtt time.Duration) {
+	if s.options.OnHeartbeat != nil {
+		s.options.OnHeartbeat(t, rtt)
+	}
+}
+
+//Latency returns the round trip time of the last PING of the client. Engine.io
+//v4 servers send PING themselves, so the client can not measure it and
+//Latency is 0.
+func (s *Session) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.rtt))
+}
+
+func (s *Session) getHandshake() Handshake {
+	s.handshakeLocker.RLock()
+	defer s.handshakeLocker.RUnlock()
+	return s.handshake
+}
+
+//setReason records why the connection is closed, only the first reason is
+//kept.
+func (s *Session) setReason(reason CloseReason, err error) {
+	s.stateLocker.Lock()
+	defer s.stateLocker.Unlock()
+	if s.reason == ReasonUnknown {
+		s.reason = reason
+		s.reasonErr = err
+	}
+}
+
+//CloseReason returns why the session is closed and the underlying error,
+//ReasonUnknown if it is not closed.
+func (s *Session) CloseReason() (CloseReason, error) {
+	s.stateLocker.RLock()
+	defer s.stateLocker.RUnlock()
+	return s.reason, s.reasonErr
+}
+
+func (s *Session) getState() state {
+	s.stateLocker.RLock()
+	defer s.stateLocker.RUnlock()
+	return s.state
+}
+
+func (s *Session) setState(state state) {
+	s.stateLocker.Lock()
+	defer s.stateLocker.Unlock()
+	s.state = state
+}
+
+//pingLoop sends PING to the server and waits for PONG. In engine.io v4 the
+//server sends PING instead, the client only checks it comes in time.
+//Either way it closes pingDone when it returns, so that readLoop stops
+//handing heartbeats over.
+func (s *Session) pingLoop() {
+	defer close(s.pingDone)
+	if s.options.protocolVersion() >= ProtocolV4 {
+		for {
+			select {
+			case ok := <-s.pingChan:
+				if !ok {
+					return
+				}
+			case <-time.After(s.pingInterval + s.pingTimeout):
+				s.closeWith(context.Background(), ReasonPingTimeout, nil)
+				return
+			}
+		}
+	}
+	lastPing := time.Now()
+	lastTry := lastPing
+	var pingSent time.Time //zero if no PING is waiting for PONG
+	for {
+		now := time.Now()
+		pingDiff := now.Sub(lastPing)
+		tryDiff := now.Sub(lastTry)
+		afterPing := s.pingInterval - tryDiff
+		afterTimeout := s.pingTimeout - pingDiff
+		select {
+		case ok := <-s.pingChan:
+			if !ok {
+				return
+			}
+			lastPing = time.Now()
+			lastTry = lastPing
+			if !pingSent.IsZero() {
+				rtt := lastPing.Sub(pingSent)
+				pingSent = time.Time{}
+				atomic.StoreInt64(&s.rtt, int64(rtt))
+				s.onHeartbeat(parser.PONG, rtt)
+			}
+		case <-time.After(afterPing):
+			if s.getState() != stateNormal {
+				return
+			}
+			//the PONG is due within afterTimeout anyway, a PING stalled
+			//longer is a ping timeout
+			ctx, cancel := context.WithTimeout(context.Background(), s.pingTimeout-time.Since(lastPing))
+			err := s.writeControl(ctx, parser.PING, nil)
+			cancel()
+			if err == context.DeadlineExceeded {
+				s.closeWith(context.Background(), ReasonPingTimeout, nil)
+				return
+			}
+			lastTry = time.Now()
+			if pingSent.IsZero() {
+				pingSent = lastTry
+				s.onHeartbeat(parser.PING, 0)
+			}
+		case <-time.After(afterTimeout):
+			s.closeWith(context.Background(), ReasonPingTimeout, nil)
+			return
+		}
+	}
+}
+
+func (s *Session) readLoop() {
+	current := s.getCurrent()
+	for {
+		pack, err := current.NextReader()
+		if err == transport.ErrPaused {
+			//hand over to upgrade, which closes the session if it gives up
+			s.pausedChan <- struct{}{}
+			return
+		}
+		if err != nil {
+			s.setReason(ReasonTransportError, err)
+			s.onClose(current)
+			return
+		}
+		s.onPacket(pack)
+		pack.Close()
+	}
+}
+
+//open connects with the transports in order, until one of them succeeds.
+func (s *Session) open(ctx context.Context) error {
+	var err error
+	for _, name := range s.options.transports() {
+		creater, ok := transport.Get(name)
+		if !ok {
+			err = fmt.Errorf("unknown transport %s", name)
+			continue
+		}
+		s.request, err = s.newRequest(ctx, nil)
+		if err != nil {
+			return err
+		}
+		var t transport.Client
+		t, err = creater.Client(s.request, s.transportOptions())
+		if err != nil {
+			continue
+		}
+		s.setCurrent(creater.Name, t)
+		return nil
+	}
+	return err
+}
+
+//upgradeCreater returns the first transport in options which the server
+//allows to upgrade to.
+func (s *Session) upgradeCreater(upgrades []string) (transport.Creater, bool) {
+	if !s.options.Upgrade {
+		return transport.Creater{}, false
+	}
+	for _, name := range s.options.transports() {
+		if name == s.currentName {
+			continue
+		}
+		creater, ok := transport.Get(name)
+		if !ok || !creater.Upgrading {
+			continue
+		}
+		for _, upgrade := range upgrades {
+			if upgrade == name {
+				return creater, true
+			}
+		}
+	}
+	return transport.Creater{}, false
+}
+
+//upgrade probes the transport of creater and switches to it. Writes are
+//sent over the old transport until the UPGRADE packet is written, so no
+//packet is lost or reordered. The old transport stays in use if probing
+//fails.
+func (s *Session) upgrade(creater transport.Creater) {
+	req, err := s.newRequest(s.request.Context(), url.Values{"sid": {s.ID()}})
+	if err != nil {
+		return
+	}
+	t, err := creater.Client(req, s.transportOptions())
+	if err != nil {
+		return
+	}
+	timer := time.AfterFunc(s.pingTimeout, func() {
+		t.Close()
+	})
+	defer timer.Stop()
+	if err := s.probe(t); err != nil {
+		t.Close()
+		return
+	}
+	old := s.getCurrent()
+	pauser, ok := old.(transport.Pauser)
+	if !ok {
+		t.Close()
+		return
+	}
+	pauser.Pause()
+	select {
+	case <-s.pausedChan:
+	case <-time.After(s.pingTimeout):
+		t.Close()
+		old.Close()
+		//nobody reads old once readLoop has handed over, close the session
+		//then, readLoop closes it otherwise
+		select {
+		case <-s.pausedChan:
+			s.onClose(old)
+		case <-s.request.Context().Done():
+		}
+		return
+	}
+	timer.Stop()
+	s.writerLocker.Lock()
+	w, err := t.NextWriter(parser.MessageText, parser.UPGRADE)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		s.writerLocker.Unlock()
+		t.Close()
+		s.onClose(old)
+		return
+	}
+	s.setCurrent(creater.Name, t)
+	s.writerLocker.Unlock()
+	old.Close()
+	go s.readLoop()
+}
+
+//probe sends a PING probe over t and waits for the PONG probe.
+func (s *Session) probe(t transport.Client) error {
+	w, err := t.NextWriter(parser.MessageText, parser.PING)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(probeData)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	r, err := t.NextReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if r.Type() != parser.PONG || string(b) != probeData {
+		return errProbeFailed
+	}
+	return nil
+}
+
+func (s *Session) transportOptions() *transport.Options {
+	opts := s.options.Transport
+	if s.unixSocket != "" {
+		opts.NetDialContext = unixDialer(s.unixSocket)
+		opts.Proxy = noProxy
+	}
+	return &opts
+}
+
+//newRequest creates the handshake request of a transport, with extra query
+//values.
+func (s *Session) newRequest(ctx context.Context, querys url.Values) (*http.Request, error) {
+	u := *s.url
+	q := u.Query()
+	for k, v := range s.options.Query {
+		q[k] = v
+	}
+	for k, v := range querys {
+		q[k] = v
+	}
+	q.Set("EIO", strconv.Itoa(s.options.protocolVersion()))
+	if s.options.ForceBase64 {
+		q.Set("b64", "1")
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range s.options.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return req, nil
+}
+
+func (s *Session) setCurrent(name string, t transport.Client) {
+	s.transportLocker.Lock()
+	defer s.transportLocker.Unlock()
+	s.currentName = name
+	s.current = t
+}
+
+func (s *Session) getCurrent() transport.Client {
+	s.transportLocker.RLock()
+	defer s.transportLocker.RUnlock()
+	return s.current
+}
@@ -0,0 +1,446 @@
+package engineio
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/memory"
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+func TestSessionUpgrade(t *testing.T) {
+	Convey("Upgrade from polling to websocket", t, func() {
+		flush := make(chan struct{})
+		upgraded := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			switch {
+			case q.Get("transport") == "websocket":
+				ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer ws.Close()
+				if _, b, err := ws.ReadMessage(); err != nil || string(b) != "2probe" {
+					return
+				}
+				ws.WriteMessage(websocket.TextMessage, []byte("3probe"))
+				close(flush)
+				_, b, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				upgraded <- string(b)
+				ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+				ws.ReadMessage()
+			case q.Get("sid") == "":
+				w.Write([]byte(`78:0{"sid":"s1","upgrades":["websocket"],"pingInterval":25000,"pingTimeout":5000}`))
+			case r.Method == "POST":
+				w.Write([]byte("ok"))
+			default:
+				<-flush
+				w.Write([]byte("1:6"))
+			}
+		}))
+		defer server.Close()
+
+		c, err := Dial(context.Background(), server.URL, &Options{Upgrade: true})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(<-upgraded, ShouldEqual, "5")
+
+		_, r, err := c.NextReader()
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		r.Close()
+		So(string(b), ShouldEqual, "hello")
+		So(c.Transport(), ShouldEqual, "websocket")
+	})
+}
+
+func TestSessionV4(t *testing.T) {
+	Convey("Answer the PING of engine.io v4 servers", t, func() {
+		pong := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("EIO") != "4" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+			ws.WriteMessage(websocket.TextMessage, []byte("2"))
+			_, b, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			pong <- string(b)
+			ws.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3})
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+
+		c, err := Dial(context.Background(), server.URL, &Options{ProtocolVersion: ProtocolV4})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(<-pong, ShouldEqual, "3")
+
+		ty, r, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(ty, ShouldEqual, parser.MessageBinary)
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		r.Close()
+		So(b, ShouldResemble, []byte{1, 2, 3})
+	})
+}
+
+func TestSessionTransports(t *testing.T) {
+	Convey("Fall back to the next transport", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("transport") != "polling" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("sid") == "" {
+				w.Write([]byte(`67:0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+				return
+			}
+			if r.Method == "POST" {
+				w.Write([]byte("ok"))
+				return
+			}
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		c, err := Dial(context.Background(), server.URL, &Options{Transports: []string{"unknown", "websocket", "polling"}})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(c.Transport(), ShouldEqual, "polling")
+
+		_, err = Dial(context.Background(), server.URL, &Options{Transports: []string{"websocket"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSessionUnixSocket(t *testing.T) {
+	Convey("Split unix url", t, func() {
+		u, err := url.Parse("unix:///run/app.sock:/realtime/?token=a")
+		So(err, ShouldBeNil)
+		u, socket := splitUnixURL(u)
+		So(socket, ShouldEqual, "/run/app.sock")
+		So(u.String(), ShouldEqual, "http://localhost/realtime/?token=a")
+
+		u, err = url.Parse("unix:///run/app.sock")
+		So(err, ShouldBeNil)
+		u, socket = splitUnixURL(u)
+		So(socket, ShouldEqual, "/run/app.sock")
+		So(u.Path, ShouldEqual, "")
+	})
+
+	Convey("Connect over unix socket", t, func() {
+		dir, err := ioutil.TempDir("", "socketio")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "app.sock")
+		listener, err := net.Listen("unix", socket)
+		So(err, ShouldBeNil)
+		paths := make(chan string, 2)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+			ws.ReadMessage()
+		}))
+		server.Listener = listener
+		server.Start()
+		defer server.Close()
+
+		for _, uri := range []string{"unix://" + socket, "unix://" + socket + ":/realtime/"} {
+			c, err := Dial(context.Background(), uri, nil)
+			So(err, ShouldBeNil)
+			c.Close()
+		}
+		So(<-paths, ShouldEqual, "/")
+		So(<-paths, ShouldEqual, "/realtime/")
+	})
+}
+
+func TestSessionPath(t *testing.T) {
+	Convey("Dial the path of the url as given", t, func() {
+		paths := make(chan string, 2)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("transport") == "polling" {
+				switch {
+				case r.URL.Query().Get("sid") == "":
+					paths <- r.URL.Path
+					w.Write([]byte(`67:0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+				case r.Method == "POST":
+					w.Write([]byte("ok"))
+				default:
+					<-r.Context().Done()
+				}
+				return
+			}
+			paths <- r.URL.Path
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"s1","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+			ws.ReadMessage()
+		})
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		for _, name := range []string{"websocket", "polling"} {
+			c, err := Dial(context.Background(), server.URL+"/engine.io/", &Options{
+				Transports: []string{name},
+			})
+			So(err, ShouldBeNil)
+			c.Close()
+			So(<-paths, ShouldEqual, "/engine.io/")
+		}
+	})
+}
+
+func TestSession(t *testing.T) {
+	Convey("Send and receive messages", t, func() {
+		server := memory.NewServer("memory-engineio")
+		transport.Register(server.Creater())
+		defer server.Close()
+		pinged := make(chan time.Duration, 1)
+		c, err := Dial(context.Background(), "http://localhost", &Options{
+			Transports: []string{"memory-engineio"},
+			OnHeartbeat: func(t parser.PacketType, rtt time.Duration) {
+				if t == parser.PONG {
+					pinged <- rtt
+				}
+			},
+		})
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s1", 50*time.Millisecond, 2500*time.Millisecond), ShouldBeNil)
+
+		So(session.Message("hello"), ShouldBeNil)
+		ty, b, err := c.Receive()
+		So(err, ShouldBeNil)
+		So(ty, ShouldEqual, parser.MessageText)
+		So(string(b), ShouldEqual, "hello")
+		So(c.ID(), ShouldEqual, "s1")
+		So(c.Transport(), ShouldEqual, "memory-engineio")
+		So(c.pingInterval, ShouldEqual, 50*time.Millisecond)
+		So(c.pingTimeout, ShouldEqual, 2500*time.Millisecond)
+
+		So(c.Send(parser.MessageText, []byte("hi")), ShouldBeNil)
+		So(session.ExpectMessage("hi"), ShouldBeNil)
+		So(c.Send(parser.MessageBinary, []byte{1, 2}), ShouldBeNil)
+		p, err := session.Read()
+		So(err, ShouldBeNil)
+		So(p.MessageType, ShouldEqual, parser.MessageBinary)
+		So(p.Data, ShouldResemble, []byte{1, 2})
+
+		So(session.Expect(parser.PING, ""), ShouldBeNil)
+		So(session.Send(parser.PONG, ""), ShouldBeNil)
+		So(<-pinged, ShouldEqual, c.Latency())
+
+		So(session.Close(), ShouldBeNil)
+		_, _, err = c.Receive()
+		So(err, ShouldEqual, io.EOF)
+		reason, _ := c.CloseReason()
+		So(reason, ShouldEqual, ReasonTransportClose)
+	})
+}
+
+func TestSessionPayload(t *testing.T) {
+	Convey("Check the size of base64 binary messages", t, func() {
+		data := make([]byte, 12) //16 bytes of base64
+		text := []Message{{Type: parser.MessageText, Data: data}}
+		binary := []Message{{Type: parser.MessageBinary, Data: data}}
+		newSession := func(opts Options, name string) *Session {
+			return &Session{
+				options:     opts,
+				currentName: name,
+				handshake:   Handshake{MaxPayload: 16},
+			}
+		}
+
+		s := newSession(Options{}, "websocket")
+		So(s.CheckPayload(text), ShouldBeNil)
+		So(s.CheckPayload(binary), ShouldBeNil)
+
+		s = newSession(Options{ForceBase64: true}, "websocket")
+		So(s.CheckPayload(text), ShouldBeNil)
+		So(s.CheckPayload(binary), ShouldResemble, &PayloadTooLargeError{Size: 18, MaxPayload: 16})
+
+		s = newSession(Options{ProtocolVersion: ProtocolV4}, "polling")
+		So(s.CheckPayload(binary), ShouldResemble, &PayloadTooLargeError{Size: 17, MaxPayload: 16})
+
+		s = newSession(Options{ProtocolVersion: ProtocolV4}, "websocket")
+		So(s.CheckPayload(binary), ShouldBeNil)
+	})
+}
+
+func TestSessionStalled(t *testing.T) {
+	Convey("Time out PING when the server stops reading", t, func() {
+		server := memory.NewServer("memory-engineio-stalled")
+		transport.Register(server.Creater())
+		defer server.Close()
+		c, err := Dial(context.Background(), "http://localhost", &Options{
+			Transports: []string{"memory-engineio-stalled"},
+		})
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s1", 20*time.Millisecond, 100*time.Millisecond), ShouldBeNil)
+
+		//fill the pipe, the last message blocks the writer
+		go func() {
+			for c.Send(parser.MessageText, []byte("x")) == nil {
+			}
+		}()
+		closed := make(chan error, 1)
+		go func() {
+			_, _, err := c.Receive()
+			closed <- err
+		}()
+		select {
+		case err := <-closed:
+			So(err, ShouldEqual, io.EOF)
+		case <-time.After(2 * time.Second):
+			So("session is not closed", ShouldBeEmpty)
+		}
+		reason, _ := c.CloseReason()
+		So(reason, ShouldNotEqual, ReasonUnknown)
+	})
+
+	Convey("Close at ping timeout while the server keeps sending PING", t, func() {
+		server := memory.NewServer("memory-engineio-stalled-ping")
+		transport.Register(server.Creater())
+		defer server.Close()
+		c, err := Dial(context.Background(), "http://localhost", &Options{
+			Transports: []string{"memory-engineio-stalled-ping"},
+		})
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s1", 50*time.Millisecond, 50*time.Millisecond), ShouldBeNil)
+
+		//fill the pipe, PONG can not be written any more
+		go func() {
+			for c.Send(parser.MessageText, []byte("x")) == nil {
+			}
+		}()
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(20 * time.Millisecond):
+					session.Ping()
+				}
+			}
+		}()
+		closed := make(chan error, 1)
+		go func() {
+			_, _, err := c.Receive()
+			closed <- err
+		}()
+		select {
+		case err := <-closed:
+			So(err, ShouldEqual, io.EOF)
+		case <-time.After(2 * time.Second):
+			So("session is not closed", ShouldBeEmpty)
+		}
+	})
+
+	Convey("Close at ping timeout of engine.io v4 while the server keeps sending PING", t, func() {
+		server := memory.NewServer("memory-engineio-stalled-ping-v4")
+		transport.Register(server.Creater())
+		defer server.Close()
+		c, err := Dial(context.Background(), "http://localhost", &Options{
+			Transports:      []string{"memory-engineio-stalled-ping-v4"},
+			ProtocolVersion: ProtocolV4,
+		})
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s1", 50*time.Millisecond, 50*time.Millisecond), ShouldBeNil)
+
+		//fill the pipe, PONG can not be written any more
+		go func() {
+			for c.Send(parser.MessageText, []byte("x")) == nil {
+			}
+		}()
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(120 * time.Millisecond): //later than pingInterval+pingTimeout
+					session.Ping()
+				}
+			}
+		}()
+		closed := make(chan error, 1)
+		go func() {
+			_, _, err := c.Receive()
+			closed <- err
+		}()
+		select {
+		case err := <-closed:
+			So(err, ShouldEqual, io.EOF)
+		case <-time.After(2 * time.Second):
+			So("session is not closed", ShouldBeEmpty)
+		}
+	})
+
+	Convey("Give up writes after WriteTimeout", t, func() {
+		server := memory.NewServer("memory-engineio-timeout")
+		transport.Register(server.Creater())
+		defer server.Close()
+		c, err := Dial(context.Background(), "http://localhost", &Options{
+			Transports:   []string{"memory-engineio-timeout"},
+			WriteTimeout: 50 * time.Millisecond,
+		})
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s1", 10*time.Second, 10*time.Second), ShouldBeNil)
+
+		for err == nil {
+			err = c.Send(parser.MessageText, []byte("x"))
+		}
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		reason, cerr := c.CloseReason()
+		So(reason, ShouldEqual, ReasonTransportError)
+		So(cerr, ShouldEqual, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,39 @@
+package engineio
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const unixScheme = "unix"
+
+//splitUnixURL splits url like unix:///run/app.sock:/realtime/ into the http
+//url http://localhost/realtime/ and the path of unix socket /run/app.sock.
+func splitUnixURL(u *url.URL) (*url.URL, string) {
+	socket, path := u.Path, ""
+	if i := strings.Index(u.Path, ":"); i >= 0 {
+		socket, path = u.Path[:i], u.Path[i+1:]
+	}
+	ret := *u
+	ret.Scheme = "http"
+	ret.Host = "localhost"
+	ret.Path = path
+	ret.RawPath = ""
+	return &ret, socket
+}
+
+//unixDialer returns dial function which connects to the unix socket, whatever
+//the address is.
+func unixDialer(socket string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
+
+func noProxy(*http.Request) (*url.URL, error) {
+	return nil, nil
+}
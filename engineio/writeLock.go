@@ -0,0 +1,38 @@
+package engineio
+
+import "context"
+
+//writeLock is a mutex which can be waited for with a context.
+type writeLock chan struct{}
+
+func newWriteLock() writeLock {
+	return make(writeLock, 1)
+}
+
+func (l writeLock) Lock() {
+	l <- struct{}{}
+}
+
+func (l writeLock) Unlock() {
+	<-l
+}
+
+//TryLock locks l if it is free, without waiting.
+func (l writeLock) TryLock() bool {
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+//LockContext locks l, or returns ctx.Err() if ctx is done first.
+func (l writeLock) LockContext(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import "context"
+
+//On registers the handler of an event taking one argument of type T. The
+//argument is decoded into T and fn is called directly, without reflection:
+//
+//	client.On(s, "chat", func(msg Message) {})
+//
+//It handles local events too, such as OnDisConnection with DisconnectReason.
+func On[T any](s *Socket, event string, fn func(T)) {
+	s.handle(event, typedHandler[T]{fn})
+}
+
+type typedHandler[T any] struct {
+	fn func(T)
+}
+
+func (h typedHandler[T]) call(decoder *decoder, packet *packet) ([]interface{}, error) {
+	arg, err := decodeArg[T](decoder, packet)
+	if err != nil {
+		return nil, err
+	}
+	h.fn(arg)
+	return nil, nil
+}
+
+func (h typedHandler[T]) fire(args []interface{}) {
+	h.fn(firstArg[T](args))
+}
+
+//Event describes an event whose message is Req and whose ack is Resp, so
+//that the compiler checks both sides of it:
+//
+//	var Add = client.NewEvent[[]int, int]("add")
+//	sum, err := Add.EmitWithAck(ctx, s, []int{1, 2})
+type Event[Req, Resp any] struct {
+	Name string
+}
+
+//NewEvent returns the event named name.
+func NewEvent[Req, Resp any](name string) Event[Req, Resp] {
+	return Event[Req, Resp]{
+		Name: name,
+	}
+}
+
+//Emit sends req without waiting for the ack.
+func (e Event[Req, Resp]) Emit(ctx context.Context, s *Socket, req Req) error {
+	return s.emit(ctx, defaultFlags, e.Name, []interface{}{req})
+}
+
+//EmitWithAck sends req and blocks until the server acks it, see
+//Socket.EmitWithAck.
+func (e Event[Req, Resp]) EmitWithAck(ctx context.Context, s *Socket, req Req) (Resp, error) {
+	var resp Resp
+	ack, err := s.EmitWithAck(ctx, e.Name, req)
+	if err != nil {
+		return resp, err
+	}
+	err = ack.Decode(&resp)
+	return resp, err
+}
+
+//On registers the handler of the event sent by the server, the result of fn
+//is the ack.
+func (e Event[Req, Resp]) On(s *Socket, fn func(Req) Resp) {
+	s.handle(e.Name, eventHandler[Req, Resp]{fn})
+}
+
+type eventHandler[Req, Resp any] struct {
+	fn func(Req) Resp
+}
+
+func (h eventHandler[Req, Resp]) call(decoder *decoder, packet *packet) ([]interface{}, error) {
+	req, err := decodeArg[Req](decoder, packet)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{h.fn(req)}, nil
+}
+
+func (h eventHandler[Req, Resp]) fire(args []interface{}) {
+	h.fn(firstArg[Req](args))
+}
+
+//decodeArg decodes the first argument of packet into T.
+func decodeArg[T any](decoder *decoder, packet *packet) (T, error) {
+	var arg T
+	args := []interface{}{&arg}
+	packet.Data = &args
+	err := decoder.DecodeData(packet)
+	return arg, err
+}
+
+//firstArg returns the first of args if it is a T, the zero value otherwise.
+func firstArg[T any](args []interface{}) T {
+	var arg T
+	if len(args) > 0 {
+		if v, ok := args[0].(T); ok {
+			arg = v
+		}
+	}
+	return arg
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+type chatMessage struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+func TestEvent(t *testing.T) {
+	Convey("Typed handlers and events", t, func() {
+		s, session, server := newTestSocket("memory-event", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		received := make(chan chatMessage, 1)
+		files := make(chan string, 1)
+		disconnected := make(chan DisconnectReason, 1)
+		On(s, OnConnection, func(struct{}) {
+			connected <- struct{}{}
+		})
+		On(s, "chat", func(m chatMessage) {
+			received <- m
+		})
+		On(s, "file", func(a *Attachment) {
+			b, _ := ioutil.ReadAll(a.Data)
+			files <- string(b)
+		})
+		On(s, OnDisConnection, func(reason DisconnectReason) {
+			disconnected <- reason
+		})
+		add := NewEvent[[]int, int]("add")
+		add.On(s, func(nums []int) int {
+			sum := 0
+			for _, n := range nums {
+				sum += n
+			}
+			return sum
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+
+		So(session.Message(`2["chat",{"from":"a","text":"hi"}]`), ShouldBeNil)
+		So(<-received, ShouldResemble, chatMessage{"a", "hi"})
+		So(session.Message(`51-["file",{"_placeholder":true,"num":0}]`), ShouldBeNil)
+		So(session.SendBinary(parser.MESSAGE, []byte("abc")), ShouldBeNil)
+		So(<-files, ShouldEqual, "abc")
+		So(session.Message(`21["add",[1,2,3]]`), ShouldBeNil)
+		So(session.ExpectMessage(`31[6]`), ShouldBeNil)
+
+		chat := NewEvent[chatMessage, bool]("chat")
+		So(chat.Emit(context.Background(), s, chatMessage{"me", "yo"}), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat",{"from":"me","text":"yo"}]`), ShouldBeNil)
+		type result struct {
+			ok  bool
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			ok, err := chat.EmitWithAck(context.Background(), s, chatMessage{"me", "ack?"})
+			done <- result{ok, err}
+		}()
+		So(session.ExpectMessage(`20["chat",{"from":"me","text":"ack?"}]`), ShouldBeNil)
+		So(session.Message(`30[true]`), ShouldBeNil)
+		So(<-done, ShouldResemble, result{true, nil})
+
+		session.Disconnect()
+		So(<-disconnected, ShouldEqual, ReasonTransportError)
+	})
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/webrtcn/go-socketio-client/engineio"
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+//frameBuffer is a FrameWriter which keeps the frames in memory.
+type frameBuffer struct {
+	frames []engineio.Message
+}
+
+func (b *frameBuffer) NextWriter(t parser.MessageType) (io.WriteCloser, error) {
+	return &frameBufferWriter{
+		buffer: b,
+		t:      t,
+	}, nil
+}
+
+type frameBufferWriter struct {
+	bytes.Buffer
+	buffer *frameBuffer
+	t      parser.MessageType
+}
+
+func (w *frameBufferWriter) Close() error {
+	w.buffer.frames = append(w.buffer.frames, engineio.Message{
+		Type: w.t,
+		Data: w.Bytes(),
+	})
+	return nil
+}
+
+//encodeFrames encodes packet p to frames, the text frame first and then
+//the binary attachments.
+func encodeFrames(p packet) ([]engineio.Message, error) {
+	var buffer frameBuffer
+	if err := newEncoder(&buffer).Encode(p); err != nil {
+		return nil, err
+	}
+	return buffer.frames, nil
+}
@@ -0,0 +1,10 @@
+package client
+
+import "github.com/webrtcn/go-socketio-client/engineio"
+
+//Handshake is the engine.io handshake sent by the server in OPEN packet.
+type Handshake = engineio.Handshake
+
+//PayloadTooLargeError is returned when a message is larger than the
+//maxPayload of the server. The message is not sent.
+type PayloadTooLargeError = engineio.PayloadTooLargeError
@@ -0,0 +1,231 @@
+//Package proxytest runs http and socks5 proxies in process for the tests of
+//the transports. A proxy can tunnel every connection to one target address,
+//so that tests connect to fake hosts like engine.test.
+package proxytest
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+//Proxy is a running proxy.
+type Proxy struct {
+	URL    *url.URL
+	close  func()
+	locker sync.Mutex
+	target string
+	hosts  []string
+}
+
+//NewHTTP starts an http proxy, which tunnels CONNECT requests and forwards
+//other requests.
+func NewHTTP() *Proxy {
+	p := &Proxy{}
+	server := httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	p.URL, _ = url.Parse(server.URL)
+	p.close = server.Close
+	return p
+}
+
+//NewSOCKS5 starts a socks5 proxy without authentication.
+func NewSOCKS5() *Proxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	p := &Proxy{
+		URL:   &url.URL{Scheme: "socks5", Host: l.Addr().String()},
+		close: func() { l.Close() },
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serveSOCKS5(conn)
+		}
+	}()
+	return p
+}
+
+//SetTarget sets the address which every connection is tunneled to, empty
+//connects to the requested hosts.
+func (p *Proxy) SetTarget(addr string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.target = addr
+}
+
+//Hosts returns the host:port requested through the proxy in order.
+func (p *Proxy) Hosts() []string {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+//Close stops the proxy.
+func (p *Proxy) Close() {
+	p.close()
+}
+
+func (p *Proxy) dial(host string) (net.Conn, error) {
+	p.locker.Lock()
+	p.hosts = append(p.hosts, host)
+	addr := p.target
+	p.locker.Unlock()
+	if addr == "" {
+		addr = host
+	}
+	return net.Dial("tcp", addr)
+}
+
+func (p *Proxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "CONNECT" {
+		p.forward(w, r)
+		return
+	}
+	dst, err := p.dial(r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	src, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+	if _, err := io.WriteString(src, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		src.Close()
+		dst.Close()
+		return
+	}
+	pipe(src, dst)
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	t := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return p.dial(addr)
+		},
+	}
+	defer t.CloseIdleConnections()
+	r.RequestURI = ""
+	resp, err := t.RoundTrip(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+var errSOCKS5 = errors.New("proxytest: unsupported socks5 request")
+
+func (p *Proxy) serveSOCKS5(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	host, err := socks5Handshake(r, conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	dst, err := p.dial(host)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) //connection refused
+		conn.Close()
+		return
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		conn.Close()
+		dst.Close()
+		return
+	}
+	if n := r.Buffered(); n > 0 {
+		b, _ := r.Peek(n)
+		dst.Write(b)
+	}
+	pipe(conn, dst)
+}
+
+//socks5Handshake accepts no authentication and reads the host:port of a
+//CONNECT request.
+func socks5Handshake(r *bufio.Reader, w io.Writer) (string, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return "", err
+	}
+	if head[0] != 5 {
+		return "", errSOCKS5
+	}
+	if _, err := io.ReadFull(r, make([]byte, head[1])); err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte{5, 0}); err != nil {
+		return "", err
+	}
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil {
+		return "", err
+	}
+	if request[0] != 5 || request[1] != 1 {
+		return "", errSOCKS5
+	}
+	var host string
+	switch request[3] {
+	case 1, 4:
+		ip := make([]byte, net.IPv4len)
+		if request[3] == 4 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", errSOCKS5
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+//pipe copies between a and b until either side is closed.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+}
@@ -0,0 +1,336 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/engineio"
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+//Manager is a connection to a socket.io server, shared by the sockets of its
+//namespaces. It reconnects when the connection is lost, and connects every
+//namespace again.
+type Manager struct {
+	uri         *url.URL
+	options     *SocketOption
+	conn        *engineio.Session
+	connLock    sync.RWMutex
+	socketsLock sync.RWMutex
+	sockets     map[string]*Socket
+	closing     bool
+	attempts    int
+}
+
+//NewManager connects to the socketio server of uri. Join namespaces with Of.
+func NewManager(uri string, options *SocketOption) (*Manager, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &SocketOption{
+			ReconnectionAttempts: 0,
+			ReconnectionDelay:    5,
+		}
+	}
+	m := &Manager{
+		uri:     u,
+		options: options,
+		sockets: make(map[string]*Socket),
+	}
+	if options.protocolVersion() < ProtocolV4 {
+		//socket.io v2 servers join every connection to the main namespace
+		m.sockets[""] = m.newSocket("")
+	}
+	go m.connect()
+	return m, nil
+}
+
+//Of returns the socket of namespace nsp, such as "/chat", and connects it.
+//The socket is the same until it is closed. Closing the last socket closes
+//the manager, whose Of returns closed sockets.
+func (m *Manager) Of(nsp string) *Socket {
+	nsp = namespaceOf(nsp)
+	m.socketsLock.Lock()
+	if s, ok := m.sockets[nsp]; ok {
+		m.socketsLock.Unlock()
+		return s
+	}
+	s := m.newSocket(nsp)
+	if m.closing {
+		m.socketsLock.Unlock()
+		s.closing = true
+		if s.queue != nil {
+			close(s.stopWriting)
+		}
+		return s
+	}
+	m.sockets[nsp] = s
+	//connect holds socketsLock too when it sets a new connection, so the
+	//socket is connected either here or by connect, never twice.
+	conn := m.getConn()
+	m.socketsLock.Unlock()
+	if conn != nil {
+		m.sendConnect(s)
+	}
+	return s
+}
+
+//Close closes the sockets of all namespaces, then the connection.
+func (m *Manager) Close(ctx context.Context) error {
+	var err error
+	for _, s := range m.allSockets() {
+		if _, cerr := s.Close(ctx); err == nil && cerr != ErrClosed {
+			err = cerr
+		}
+	}
+	if cerr := m.close(ctx); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (m *Manager) newSocket(nsp string) *Socket {
+	s := &Socket{
+		manager:   m,
+		namespace: nsp,
+		events:    make(map[string]handler),
+		acks:      make(map[int]*pendingAck),
+		idle:      make(chan struct{}, 1),
+		options:   m.options,
+	}
+	if m.options.SendQueueSize > 0 {
+		s.queue = newSendQueue(m.options.SendQueueSize, m.options.SendQueuePolicy)
+		s.stopWriting = make(chan struct{})
+		go s.writeLoop()
+	}
+	return s
+}
+
+//namespaceOf returns the name of namespace nsp in packets, which is empty for
+//the main namespace.
+func namespaceOf(nsp string) string {
+	if nsp == "" || nsp == "/" {
+		return ""
+	}
+	if !strings.HasPrefix(nsp, "/") {
+		return "/" + nsp
+	}
+	return nsp
+}
+
+//namespaceName returns the name of namespace nsp of packets, which is "/" for
+//the main namespace.
+func namespaceName(nsp string) string {
+	if nsp == "" {
+		return "/"
+	}
+	return nsp
+}
+
+func (m *Manager) connect() {
+	for {
+		if m.isClosing() {
+			m.attempts = 0
+			break
+		}
+		if m.options.ReconnectionAttempts > 0 {
+			if m.attempts > m.options.ReconnectionAttempts {
+				m.fire(OnReconnectFailed)
+				break
+			} else {
+				m.attempts++
+			}
+		}
+		m.fire(OnConnecting)
+		conn, err := newConn(m.uri, m.options, m.onHeartbeat)
+		if err != nil {
+			if m.options.ReconnectionDelay <= 0 {
+				m.options.ReconnectionDelay = 5
+			}
+			time.Sleep(time.Duration(m.options.ReconnectionDelay) * time.Second)
+		} else {
+			m.socketsLock.Lock()
+			m.connLock.Lock()
+			m.conn = conn
+			m.connLock.Unlock()
+			closing := m.closing
+			sockets := make([]*Socket, 0, len(m.sockets))
+			for _, s := range m.sockets {
+				sockets = append(sockets, s)
+			}
+			m.socketsLock.Unlock()
+			if closing { //closed while connecting
+				conn.Close()
+			}
+			m.attempts = 0
+			go m.readLoop(conn)
+			for _, s := range sockets {
+				if err := m.sendConnect(s); err != nil {
+					conn.Close()
+					break
+				}
+			}
+			break
+		}
+	}
+}
+
+//sendConnect sends CONNECT packet of the namespace of s. Socket.io v2 servers
+//connect the main namespace themselves.
+func (m *Manager) sendConnect(s *Socket) error {
+	if s.namespace == "" && m.options.protocolVersion() < ProtocolV4 {
+		return nil
+	}
+	return s.sendConnect()
+}
+
+func (m *Manager) getConn() *engineio.Session {
+	m.connLock.RLock()
+	defer m.connLock.RUnlock()
+	return m.conn
+}
+
+func (m *Manager) isClosing() bool {
+	m.socketsLock.RLock()
+	defer m.socketsLock.RUnlock()
+	return m.closing
+}
+
+//close stops reconnecting and closes the connection, without CLOSE packet if
+//ctx is done first.
+func (m *Manager) close(ctx context.Context) error {
+	m.socketsLock.Lock()
+	m.closing = true
+	m.socketsLock.Unlock()
+	if conn := m.getConn(); conn != nil {
+		return conn.CloseContext(ctx)
+	}
+	return nil
+}
+
+//remove removes closed socket s, and closes the manager within ctx if s is
+//the last one.
+func (m *Manager) remove(ctx context.Context, s *Socket) error {
+	m.socketsLock.Lock()
+	if m.sockets[s.namespace] == s {
+		delete(m.sockets, s.namespace)
+	}
+	last := len(m.sockets) == 0
+	m.socketsLock.Unlock()
+	if !last {
+		return nil
+	}
+	return m.close(ctx)
+}
+
+func (m *Manager) socket(nsp string) *Socket {
+	m.socketsLock.RLock()
+	defer m.socketsLock.RUnlock()
+	return m.sockets[namespaceOf(nsp)]
+}
+
+func (m *Manager) allSockets() []*Socket {
+	m.socketsLock.RLock()
+	defer m.socketsLock.RUnlock()
+	sockets := make([]*Socket, 0, len(m.sockets))
+	for _, s := range m.sockets {
+		sockets = append(sockets, s)
+	}
+	return sockets
+}
+
+//connected returns whether any namespace is connected.
+func (m *Manager) connected() bool {
+	for _, s := range m.allSockets() {
+		if s.isConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+//fire calls the handlers of a local event in every namespace.
+func (m *Manager) fire(message string, args ...interface{}) {
+	for _, s := range m.allSockets() {
+		s.fire(message, args...)
+	}
+}
+
+//onHeartbeat fires OnPing when a PING is sent or received, and OnPong with
+//the round trip time when the PONG of the server comes in.
+func (m *Manager) onHeartbeat(t parser.PacketType, rtt time.Duration) {
+	switch t {
+	case parser.PING:
+		m.fire(OnPing)
+	case parser.PONG:
+		m.fire(OnPong, rtt)
+	}
+}
+
+//onDisconnect disconnects every namespace with the reason and reconnects.
+func (m *Manager) onDisconnect(reason DisconnectReason, err error) {
+	for _, s := range m.allSockets() {
+		s.onDisconnect(reason, err)
+	}
+	go m.connect()
+}
+
+//readLoop reads the packets of conn and routes them to the sockets of their
+//namespaces, until conn is closed.
+func (m *Manager) readLoop(conn *engineio.Session) (err error) {
+	reason := ReasonParseError
+	defer func() {
+		//the reason of a closed session wins, like a transport error
+		//breaking the packet being decoded
+		if r, cerr := conn.CloseReason(); r != engineio.ReasonUnknown {
+			reason, err = disconnectReason(r), cerr
+		} else {
+			conn.Close()
+		}
+		m.onDisconnect(reason, err)
+	}()
+	for {
+		decoder := newDecoder(conn)
+		var p packet
+		if err := decoder.Decode(&p); err != nil {
+			return err
+		}
+		socket := m.socket(p.NSP)
+		if socket == nil { //not joined, or closed
+			decoder.Close()
+			continue
+		}
+		ret, err := socket.onPacket(decoder, &p)
+		if err != nil {
+			return err
+		}
+		switch p.Type {
+		case _BINARY_EVENT:
+			fallthrough
+		case _EVENT:
+			if p.Id >= 0 {
+				p := packet{
+					Type: _ACK,
+					Id:   p.Id,
+					NSP:  socket.namespace,
+					Data: ret,
+				}
+				if err := socket.writePacket(context.Background(), defaultFlags, p); err != nil {
+					reason = ReasonTransportError
+					return err
+				}
+			}
+		case _DISCONNECT:
+			socket.onDisconnect(ReasonServerDisconnect, nil)
+			if !m.connected() { //nothing left to keep the connection for
+				reason = ReasonServerDisconnect
+				return nil
+			}
+		}
+	}
+}
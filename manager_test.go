@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+func TestManager(t *testing.T) {
+	Convey("Namespaces share the connection", t, func() {
+		s, session, server := newTestSocket("memory-manager", nil)
+		defer server.Close()
+		chat := s.Manager().Of("chat")
+		So(chat.Namespace(), ShouldEqual, "/chat")
+		So(s.Manager().Of("/chat"), ShouldEqual, chat)
+		So(s.Manager().Of("/"), ShouldEqual, s)
+		So(session.ExpectMessage("0/chat"), ShouldBeNil)
+
+		connected := make(chan string, 2)
+		received := make(chan string, 2)
+		s.On(OnConnection, func() {
+			connected <- "/"
+		})
+		s.On("msg", func(msg string) {
+			received <- "/ " + msg
+		})
+		chat.On(OnConnection, func() {
+			connected <- "/chat"
+		})
+		chat.On("msg", func(msg string) {
+			received <- "/chat " + msg
+		})
+		So(session.Message("0"), ShouldBeNil)
+		So(<-connected, ShouldEqual, "/")
+		So(session.Message("0/chat,"), ShouldBeNil)
+		So(<-connected, ShouldEqual, "/chat")
+
+		So(session.Message(`2/chat,["msg","hi"]`), ShouldBeNil)
+		So(<-received, ShouldEqual, "/chat hi")
+		So(session.Message(`2["msg","hello"]`), ShouldBeNil)
+		So(<-received, ShouldEqual, "/ hello")
+
+		acked := make(chan string, 2)
+		So(s.Emit("query", func(r string) {
+			acked <- "/ " + r
+		}), ShouldBeNil)
+		So(chat.Emit("query", func(r string) {
+			acked <- "/chat " + r
+		}), ShouldBeNil)
+		So(session.ExpectMessage(`20["query"]`), ShouldBeNil)
+		So(session.ExpectMessage(`2/chat,0["query"]`), ShouldBeNil)
+		So(session.Message(`3/chat,0["b"]`), ShouldBeNil)
+		So(<-acked, ShouldEqual, "/chat b")
+		So(session.Message(`30["a"]`), ShouldBeNil)
+		So(<-acked, ShouldEqual, "/ a")
+	})
+
+	Convey("Server disconnects one namespace", t, func() {
+		s, session, server := newTestSocket("memory-manager-disconnect", &SocketOption{ProtocolVersion: ProtocolV4})
+		defer server.Close()
+		So(session.ExpectMessage("0"), ShouldBeNil)
+		admin := s.Manager().Of("/admin")
+		So(session.ExpectMessage("0/admin"), ShouldBeNil)
+		disconnected := make(chan DisconnectReason, 1)
+		admin.On(OnDisConnection, func(reason DisconnectReason) {
+			disconnected <- reason
+		})
+		connected := make(chan struct{}, 1)
+		admin.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message(`0{"sid":"a"}`), ShouldBeNil)
+		So(session.Message(`0/admin,{"sid":"b"}`), ShouldBeNil)
+		<-connected
+		So(admin.GetSessionID(), ShouldEqual, "b")
+
+		So(session.Message("1/admin,"), ShouldBeNil)
+		So(<-disconnected, ShouldEqual, ReasonServerDisconnect)
+		So(s.Emit("chat"), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat"]`), ShouldBeNil)
+
+		_, err := admin.Close(context.Background())
+		So(err, ShouldBeNil)
+		So(s.Manager().Of("/admin"), ShouldNotEqual, admin)
+		So(session.ExpectMessage("1/admin"), ShouldBeNil)
+		So(session.ExpectMessage("0/admin"), ShouldBeNil)
+		_, err = s.Manager().Of("/admin").Close(context.Background())
+		So(err, ShouldBeNil)
+		So(session.ExpectMessage("1/admin"), ShouldBeNil)
+		So(s.Manager().Close(context.Background()), ShouldBeNil)
+		So(session.ExpectMessage("1"), ShouldBeNil)
+		So(session.Expect(parser.CLOSE, ""), ShouldBeNil)
+	})
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+type client struct {
+	pipe     *pipe
+	response *http.Response
+}
+
+func (c *client) Response() *http.Response {
+	return c.response
+}
+
+func (c *client) NextReader() (*parser.PacketDecoder, error) {
+	f, err := c.pipe.receive(c.pipe.toClient, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parser.NewDecoder(bytes.NewReader(f.data))
+}
+
+func (c *client) NextWriter(msgType parser.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	select {
+	case <-c.pipe.done:
+		return nil, io.EOF
+	default:
+	}
+	return newFrameWriter(msgType, packetType, func(f frame) error {
+		return c.pipe.send(c.pipe.toServer, f)
+	})
+}
+
+func (c *client) Close() error {
+	c.pipe.close()
+	return nil
+}
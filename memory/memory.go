@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+//ErrClosed is returned when dialing a closed server.
+var ErrClosed = errors.New("memory: server closed")
+
+//Server is a fake engine.io server in memory. Connect it with the creater
+//returned by Creater, and script each connection with the Session returned by
+//Accept.
+type Server struct {
+	name      string
+	sessions  chan *Session
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+//NewServer create a new server whose transport is named name.
+func NewServer(name string) *Server {
+	return &Server{
+		name:     name,
+		sessions: make(chan *Session, bufferSize),
+		closed:   make(chan struct{}),
+	}
+}
+
+//Creater return the creater connecting to the server. Register it with
+//transport.Register to use it by name.
+func (s *Server) Creater() transport.Creater {
+	return transport.Creater{
+		Name:      s.name,
+		Upgrading: true,
+		Client:    s.dial,
+	}
+}
+
+//Accept returns the next connection made to the server.
+func (s *Server) Accept() (*Session, error) {
+	select {
+	case session := <-s.sessions:
+		return session, nil
+	case <-s.closed:
+		return nil, ErrClosed
+	}
+}
+
+//Close closes the server, new connections will fail.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+func (s *Server) dial(r *http.Request, opts *transport.Options) (transport.Client, error) {
+	select {
+	case <-s.closed:
+		return nil, ErrClosed
+	default:
+	}
+	p := newPipe()
+	session := &Session{
+		pipe:    p,
+		request: r,
+	}
+	select {
+	case s.sessions <- session:
+	case <-s.closed:
+		return nil, ErrClosed
+	}
+	return &client{
+		pipe: p,
+		response: &http.Response{
+			StatusCode: http.StatusSwitchingProtocols,
+			Request:    r,
+		},
+	}, nil
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+func TestMemory(t *testing.T) {
+	Convey("Script a connection", t, func() {
+		server := NewServer("memory-test")
+		defer server.Close()
+		creater := server.Creater()
+		So(creater.Name, ShouldEqual, "memory-test")
+
+		req, err := http.NewRequest("GET", "http://localhost/socket.io/", nil)
+		So(err, ShouldBeNil)
+		c, err := creater.Client(req, nil)
+		So(err, ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Request(), ShouldEqual, req)
+
+		So(session.Open("s1", time.Second, time.Second), ShouldBeNil)
+		So(session.Message("hello"), ShouldBeNil)
+		So(session.SendBinary(parser.MESSAGE, []byte{1, 2}), ShouldBeNil)
+
+		decoder, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.OPEN)
+		b, _ := ioutil.ReadAll(decoder)
+		So(string(b), ShouldEqual, `{"sid":"s1","upgrades":[],"pingInterval":1000,"pingTimeout":1000}`)
+		decoder, err = c.NextReader()
+		So(err, ShouldBeNil)
+		b, _ = ioutil.ReadAll(decoder)
+		So(string(b), ShouldEqual, "hello")
+		decoder, err = c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.MessageType(), ShouldEqual, parser.MessageBinary)
+		b, _ = ioutil.ReadAll(decoder)
+		So(b, ShouldResemble, []byte{1, 2})
+
+		w, err := c.NextWriter(parser.MessageText, parser.MESSAGE)
+		So(err, ShouldBeNil)
+		w.Write([]byte("world"))
+		So(w.Close(), ShouldBeNil)
+		So(session.ExpectMessage("world"), ShouldBeNil)
+
+		w, err = c.NextWriter(parser.MessageText, parser.PING)
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		So(session.ExpectMessage("world"), ShouldNotBeNil)
+
+		So(session.Close(), ShouldBeNil)
+		decoder, err = c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.CLOSE)
+		_, err = c.NextReader()
+		So(err, ShouldEqual, io.EOF)
+		_, err = c.NextWriter(parser.MessageText, parser.MESSAGE)
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Dial closed server", t, func() {
+		server := NewServer("memory-test")
+		server.Close()
+		req, err := http.NewRequest("GET", "http://localhost/socket.io/", nil)
+		So(err, ShouldBeNil)
+		_, err = server.Creater().Client(req, nil)
+		So(err, ShouldEqual, ErrClosed)
+	})
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+const bufferSize = 64 //frames buffered in each direction
+
+//frame is one encoded packet, as a websocket message.
+type frame struct {
+	msgType parser.MessageType
+	data    []byte
+}
+
+type pipe struct {
+	toClient  chan frame
+	toServer  chan frame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipe() *pipe {
+	return &pipe{
+		toClient: make(chan frame, bufferSize),
+		toServer: make(chan frame, bufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *pipe) send(ch chan frame, f frame) error {
+	select {
+	case <-p.done:
+		return io.EOF
+	default:
+	}
+	select {
+	case ch <- f:
+		return nil
+	case <-p.done:
+		return io.EOF
+	}
+}
+
+//receive returns the next frame of ch. The frames sent before closing are
+//still received.
+func (p *pipe) receive(ch chan frame, timeout <-chan time.Time) (frame, error) {
+	select {
+	case f := <-ch:
+		return f, nil
+	default:
+	}
+	select {
+	case f := <-ch:
+		return f, nil
+	case <-p.done:
+		return frame{}, io.EOF
+	case <-timeout:
+		return frame{}, ErrTimeout
+	}
+}
+
+func (p *pipe) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+//frameWriter encodes one packet and sends it when closed.
+type frameWriter struct {
+	*parser.PacketEncoder
+	buf  *bytes.Buffer
+	send func(frame) error
+	t    parser.MessageType
+}
+
+func newFrameWriter(t parser.MessageType, packetType parser.PacketType, send func(frame) error) (*frameWriter, error) {
+	buf := bytes.NewBuffer(nil)
+	newEncoder := parser.NewStringEncoder
+	if t == parser.MessageBinary {
+		newEncoder = parser.NewBinaryEncoder
+	}
+	encoder, err := newEncoder(buf, packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &frameWriter{
+		PacketEncoder: encoder,
+		buf:           buf,
+		send:          send,
+		t:             t,
+	}, nil
+}
+
+func (w *frameWriter) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		return err
+	}
+	return w.send(frame{
+		msgType: w.t,
+		data:    w.buf.Bytes(),
+	})
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+)
+
+//ReadTimeout is how long Read waits for the client.
+const ReadTimeout = 5 * time.Second
+
+//ErrTimeout is returned when the client writes nothing in ReadTimeout.
+var ErrTimeout = errors.New("memory: read timeout")
+
+//Packet is a packet written by the client.
+type Packet struct {
+	Type        parser.PacketType
+	MessageType parser.MessageType
+	Data        []byte
+}
+
+//String returns the packet as engine.io string, like 4hello.
+func (p Packet) String() string {
+	return fmt.Sprintf("%c%s", p.Type.Byte()+'0', p.Data)
+}
+
+//Session is the server side of a connection.
+type Session struct {
+	pipe    *pipe
+	request *http.Request
+}
+
+//Request returns the handshake request of the client.
+func (s *Session) Request() *http.Request {
+	return s.request
+}
+
+//Open sends OPEN packet with the session id and the heartbeat.
+func (s *Session) Open(sid string, pingInterval, pingTimeout time.Duration) error {
+	b, err := json.Marshal(struct {
+		SessionID    string   `json:"sid"`
+		Upgrades     []string `json:"upgrades"`
+		PingInterval int64    `json:"pingInterval"`
+		PingTimeout  int64    `json:"pingTimeout"`
+	}{
+		SessionID:    sid,
+		Upgrades:     []string{},
+		PingInterval: int64(pingInterval / time.Millisecond),
+		PingTimeout:  int64(pingTimeout / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	return s.Send(parser.OPEN, string(b))
+}
+
+//Send sends a string packet.
+func (s *Session) Send(t parser.PacketType, data string) error {
+	return s.send(parser.MessageText, t, []byte(data))
+}
+
+//SendBinary sends a binary packet.
+func (s *Session) SendBinary(t parser.PacketType, data []byte) error {
+	return s.send(parser.MessageBinary, t, data)
+}
+
+func (s *Session) send(msgType parser.MessageType, t parser.PacketType, data []byte) error {
+	w, err := newFrameWriter(msgType, t, func(f frame) error {
+		return s.pipe.send(s.pipe.toClient, f)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+//Message sends MESSAGE packet, data is usually a socket.io packet.
+func (s *Session) Message(data string) error {
+	return s.Send(parser.MESSAGE, data)
+}
+
+//Ping sends PING packet.
+func (s *Session) Ping() error {
+	return s.Send(parser.PING, "")
+}
+
+//Close sends CLOSE packet and closes the connection.
+func (s *Session) Close() error {
+	err := s.Send(parser.CLOSE, "")
+	s.pipe.close()
+	return err
+}
+
+//Disconnect closes the connection without CLOSE packet, like a network
+//failure.
+func (s *Session) Disconnect() {
+	s.pipe.close()
+}
+
+//Read returns the next packet written by the client.
+func (s *Session) Read() (Packet, error) {
+	f, err := s.pipe.receive(s.pipe.toServer, time.After(ReadTimeout))
+	if err != nil {
+		return Packet{}, err
+	}
+	decoder, err := parser.NewDecoder(bytes.NewReader(f.data))
+	if err != nil {
+		return Packet{}, err
+	}
+	data, err := ioutil.ReadAll(decoder)
+	if err != nil {
+		return Packet{}, err
+	}
+	return Packet{
+		Type:        decoder.Type(),
+		MessageType: f.msgType,
+		Data:        data,
+	}, nil
+}
+
+//Expect reads the next packet, and returns error if it is not the string
+//packet t with data.
+func (s *Session) Expect(t parser.PacketType, data string) error {
+	p, err := s.Read()
+	if err != nil {
+		return err
+	}
+	if p.Type != t || p.MessageType != parser.MessageText || string(p.Data) != data {
+		return fmt.Errorf("memory: expect %c%s, got %s", t.Byte()+'0', data, p)
+	}
+	return nil
+}
+
+//ExpectMessage reads the next packet, and returns error if it is not the
+//MESSAGE packet with data.
+func (s *Session) ExpectMessage(data string) error {
+	return s.Expect(parser.MESSAGE, data)
+}
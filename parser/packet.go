@@ -103,6 +103,29 @@ func NewB64Encoder(w io.Writer, t PacketType) (*PacketEncoder, error) {
 	}, nil
 }
 
+//NewB64EncoderV4 return the encoder which encode a binary message to writer w as an engine.io v4
+//string packet, 'b' followed by base64 data.
+func NewB64EncoderV4(w io.Writer) (*PacketEncoder, error) {
+	if _, err := w.Write([]byte{'b'}); err != nil {
+		return nil, err
+	}
+	base := base64.NewEncoder(base64.StdEncoding, w)
+	return &PacketEncoder{
+		closer: base,
+		w:      base,
+	}, nil
+}
+
+//NewRawEncoder return the encoder which encode a binary message to writer w without packet type,
+//as engine.io v4 binary frames.
+func NewRawEncoder(w io.Writer) *PacketEncoder {
+	closer, _ := w.(io.Closer)
+	return &PacketEncoder{
+		closer: closer,
+		w:      w,
+	}
+}
+
 //Write writes bytes p and follow the packettype
 func (pe *PacketEncoder) Write(p []byte) (int, error) {
 	return pe.w.Write(p)
@@ -166,6 +189,55 @@ func NewDecoder(r io.Reader) (*PacketDecoder, error) {
 	return ret, nil
 }
 
+//NewDecoderV4 return the decoder which decode an engine.io v4 string packet from reader r.
+//Packets start with 'b' are base64 encoded binary messages.
+func NewDecoderV4(r io.Reader) (*PacketDecoder, error) {
+	var closer io.Closer
+	if limit, ok := r.(*limitReader); ok {
+		closer = limit
+	}
+	defer func() {
+		if closer != nil {
+			closer.Close()
+		}
+	}()
+	b := []byte{0xff}
+	if _, err := r.Read(b); err != nil {
+		return nil, err
+	}
+	ret := &PacketDecoder{
+		closer:  closer,
+		r:       r,
+		msgType: MessageText,
+	}
+	if b[0] == 'b' {
+		ret.r = base64.NewDecoder(base64.StdEncoding, r)
+		ret.t = MESSAGE
+		ret.msgType = MessageBinary
+		closer = nil
+		return ret, nil
+	}
+	t, err := ByteToType(b[0] - '0')
+	if err != nil {
+		return nil, err
+	}
+	ret.t = t
+	closer = nil
+	return ret, nil
+}
+
+//NewRawDecoder return the decoder which decode a binary message without packet type from
+//reader r, as engine.io v4 binary frames.
+func NewRawDecoder(r io.Reader) *PacketDecoder {
+	closer, _ := r.(io.Closer)
+	return &PacketDecoder{
+		closer:  closer,
+		r:       r,
+		t:       MESSAGE,
+		msgType: MessageBinary,
+	}
+}
+
 //Read reads packet data to bytes p.
 func (d *PacketDecoder) Read(p []byte) (int, error) {
 	return d.r.Read(p)
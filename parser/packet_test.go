@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -272,3 +273,47 @@ func TestLimitReaderDecoder(t *testing.T) {
 		So(buf.String(), ShouldEqual, "123")
 	})
 }
+
+func TestV4Parser(t *testing.T) {
+	Convey("Base64 binary message", t, func() {
+		buf := bytes.NewBuffer(nil)
+		encoder, err := NewB64EncoderV4(buf)
+		So(err, ShouldBeNil)
+		encoder.Write([]byte{1, 2, 3})
+		So(encoder.Close(), ShouldBeNil)
+		So(buf.String(), ShouldEqual, "bAQID")
+
+		decoder, err := NewDecoderV4(buf)
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, MESSAGE)
+		So(decoder.MessageType(), ShouldEqual, MessageBinary)
+		b, err := ioutil.ReadAll(decoder)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, []byte{1, 2, 3})
+	})
+
+	Convey("String packet", t, func() {
+		decoder, err := NewDecoderV4(bytes.NewBufferString("4test"))
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, MESSAGE)
+		So(decoder.MessageType(), ShouldEqual, MessageText)
+		b, err := ioutil.ReadAll(decoder)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "test")
+	})
+
+	Convey("Raw binary message", t, func() {
+		buf := bytes.NewBuffer(nil)
+		encoder := NewRawEncoder(buf)
+		encoder.Write([]byte{1, 2, 3})
+		So(encoder.Close(), ShouldBeNil)
+		So(buf.Bytes(), ShouldResemble, []byte{1, 2, 3})
+
+		decoder := NewRawDecoder(buf)
+		So(decoder.Type(), ShouldEqual, MESSAGE)
+		So(decoder.MessageType(), ShouldEqual, MessageBinary)
+		b, err := ioutil.ReadAll(decoder)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, []byte{1, 2, 3})
+	})
+}
@@ -0,0 +1,298 @@
+package polling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+const (
+	protocol                = 3 //engine.io version
+	eioKey                  = "EIO"
+	b64Key                  = "b64" //binary messages are sent as base64 text when set
+	transportKey            = "transport"
+	transportValue          = "polling"
+	sidKey                  = "sid"
+	timestampKey            = "t"
+	webSocketProtocol       = "ws"
+	webSocketSecureProtocol = "wss"
+	httpProtocol            = "http"
+	httpSecureProtocol      = "https"
+	//defaultHandshakeTimeout bounds the handshake request, like the
+	//websocket dialer
+	defaultHandshakeTimeout = 45 * time.Second
+)
+
+type client struct {
+	url            url.URL
+	header         http.Header
+	httpClient     *http.Client
+	queue          [][]byte
+	responseLocker sync.Mutex
+	response       *http.Response
+	ctx            context.Context
+	cancel         context.CancelFunc
+	paused         int32
+	version        int
+	base64         bool
+}
+
+//NewClient create a new client instance. It sends the handshake request, the
+//OPEN packet is returned by the first call of NextReader. opts can be nil.
+func NewClient(req *http.Request, opts *transport.Options) (transport.Client, error) {
+	switch req.URL.Scheme {
+	case webSocketProtocol:
+		req.URL.Scheme = httpProtocol
+	case webSocketSecureProtocol:
+		req.URL.Scheme = httpSecureProtocol
+	}
+	if opts != nil && opts.Path != "" {
+		req.URL.Path = opts.Path
+	}
+	querys := req.URL.Query()
+	if v := querys.Get(eioKey); len(v) == 0 {
+		querys.Add(eioKey, strconv.Itoa(protocol))
+	}
+	querys.Set(transportKey, transportValue)
+	req.URL.RawQuery = querys.Encode()
+	version, err := strconv.Atoi(querys.Get(eioKey))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	c := &client{
+		url:        *req.URL,
+		header:     req.Header,
+		httpClient: newHTTPClient(opts),
+		ctx:        ctx,
+		cancel:     cancel,
+		version:    version,
+		base64:     querys.Get(b64Key) != "",
+	}
+	timeout := defaultHandshakeTimeout
+	if opts != nil && opts.HandshakeTimeout > 0 {
+		timeout = opts.HandshakeTimeout
+	}
+	handshakeCtx, cancelHandshake := context.WithTimeout(ctx, timeout)
+	defer cancelHandshake()
+	if err := c.handshake(handshakeCtx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newHTTPClient(opts *transport.Options) *http.Client {
+	if opts == nil {
+		return &http.Client{}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = opts.TLSClientConfig
+	if opts.HandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = opts.HandshakeTimeout
+	}
+	if opts.ReadBufferSize > 0 {
+		t.ReadBufferSize = opts.ReadBufferSize
+	}
+	if opts.WriteBufferSize > 0 {
+		t.WriteBufferSize = opts.WriteBufferSize
+	}
+	if opts.NetDialContext != nil {
+		t.DialContext = opts.NetDialContext
+	}
+	if opts.Proxy != nil {
+		t.Proxy = opts.Proxy
+	}
+	return &http.Client{
+		Transport: t,
+		Jar:       opts.Jar,
+	}
+}
+
+//handshake polls the OPEN packet within ctx.
+func (c *client) handshake(ctx context.Context) error {
+	if err := c.poll(ctx); err != nil {
+		return err
+	}
+	if len(c.queue) == 0 {
+		return errInvalidPayload
+	}
+	open, err := c.newDecoder(c.queue[0])
+	if err != nil {
+		return err
+	}
+	if open.Type() != parser.OPEN {
+		return fmt.Errorf("unexpected packet %s in handshake", open.Type())
+	}
+	var conninfo struct {
+		SessionID string `json:"sid"`
+	}
+	if err := json.NewDecoder(open).Decode(&conninfo); err != nil {
+		return err
+	}
+	querys := c.url.Query()
+	querys.Set(sidKey, conninfo.SessionID)
+	c.url.RawQuery = querys.Encode()
+	return nil
+}
+
+func (c *client) Response() *http.Response {
+	c.responseLocker.Lock()
+	defer c.responseLocker.Unlock()
+	return c.response
+}
+
+func (c *client) NextReader() (*parser.PacketDecoder, error) {
+	for len(c.queue) == 0 {
+		if atomic.LoadInt32(&c.paused) == 1 {
+			return nil, transport.ErrPaused
+		}
+		if err := c.poll(c.ctx); err != nil {
+			return nil, err
+		}
+	}
+	p := c.queue[0]
+	c.queue = c.queue[1:]
+	return c.newDecoder(p)
+}
+
+func (c *client) newDecoder(p []byte) (*parser.PacketDecoder, error) {
+	if c.version >= 4 {
+		return parser.NewDecoderV4(bytes.NewReader(p))
+	}
+	return parser.NewDecoder(bytes.NewReader(p))
+}
+
+func (c *client) NextWriter(msgType parser.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, io.EOF
+	}
+	buf := bytes.NewBuffer(nil)
+	var ret *parser.PacketEncoder
+	var err error
+	switch {
+	case msgType != parser.MessageBinary:
+		ret, err = parser.NewStringEncoder(buf, packetType)
+	case c.version >= 4:
+		ret, err = parser.NewB64EncoderV4(buf)
+	case c.base64:
+		ret, err = parser.NewB64Encoder(buf, packetType)
+	default:
+		ret, err = parser.NewBinaryEncoder(buf, packetType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &writer{
+		PacketEncoder: ret,
+		client:        c,
+		buf:           buf,
+		binary:        msgType == parser.MessageBinary && !c.base64,
+	}, nil
+}
+
+//Pause stops polling after the running request returns.
+func (c *client) Pause() {
+	atomic.StoreInt32(&c.paused, 1)
+}
+
+func (c *client) Close() error {
+	c.cancel()
+	return nil
+}
+
+//poll sends a GET request and appends the packets of the response to queue.
+func (c *client) poll(ctx context.Context) error {
+	resp, err := c.do(ctx, "GET", "", nil)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	packets, err := decodePayload(resp.Header.Get("Content-Type"), body, c.version)
+	if err != nil {
+		return err
+	}
+	c.queue = append(c.queue, packets...)
+	return nil
+}
+
+func (c *client) post(p packet) error {
+	buf := bytes.NewBuffer(nil)
+	contentType, err := encodePacket(buf, p, c.version)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(c.ctx, "POST", contentType, buf)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (c *client) do(ctx context.Context, method, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.url
+	querys := u.Query()
+	querys.Set(timestampKey, strconv.FormatInt(time.Now().UnixNano(), 36))
+	u.RawQuery = querys.Encode()
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if c.ctx.Err() != nil {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	c.responseLocker.Lock()
+	c.response = resp
+	c.responseLocker.Unlock()
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("polling: unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+//writer buffers one packet and posts it to the server when closed.
+type writer struct {
+	*parser.PacketEncoder
+	client *client
+	buf    *bytes.Buffer
+	binary bool
+}
+
+func (w *writer) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		return err
+	}
+	return w.client.post(packet{
+		binary: w.binary,
+		data:   w.buf.Bytes(),
+	})
+}
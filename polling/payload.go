@@ -0,0 +1,141 @@
+package polling
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	binaryContentType = "application/octet-stream"
+	textContentType   = "text/plain;charset=UTF-8"
+	binarySeparator   = 0xff
+	recordSeparator   = 0x1e
+	stringFlag        = 0
+	binaryFlag        = 1
+)
+
+var errInvalidPayload = errors.New("invalid payload")
+
+//packet is one engine.io packet inside a payload, already encoded by parser.
+type packet struct {
+	binary bool
+	data   []byte
+}
+
+//encodePacket writes p to w as a single packet payload. In engine.io v3 text
+//packets use "<length>:<packet>" framing, binary packets use the XHR2 binary
+//framing. Engine.io v4 packets are always strings and need no framing.
+//It returns the content type of the payload.
+func encodePacket(w io.Writer, p packet, version int) (string, error) {
+	if version >= 4 {
+		_, err := w.Write(p.data)
+		return textContentType, err
+	}
+	if !p.binary {
+		if _, err := fmt.Fprintf(w, "%d:", utf16Len(p.data)); err != nil {
+			return "", err
+		}
+		_, err := w.Write(p.data)
+		return textContentType, err
+	}
+	length := strconv.Itoa(len(p.data))
+	head := make([]byte, 0, len(length)+2)
+	head = append(head, binaryFlag)
+	for i := 0; i < len(length); i++ {
+		head = append(head, length[i]-'0')
+	}
+	head = append(head, binarySeparator)
+	if _, err := w.Write(head); err != nil {
+		return "", err
+	}
+	_, err := w.Write(p.data)
+	return binaryContentType, err
+}
+
+//decodePayload splits the body of a polling response into packets.
+func decodePayload(contentType string, body []byte, version int) ([][]byte, error) {
+	if version >= 4 {
+		if len(body) == 0 {
+			return nil, nil
+		}
+		return bytes.Split(body, []byte{recordSeparator}), nil
+	}
+	if strings.HasPrefix(contentType, binaryContentType) {
+		return decodeBinaryPayload(body)
+	}
+	return decodeTextPayload(body)
+}
+
+func decodeTextPayload(body []byte) ([][]byte, error) {
+	var ret [][]byte
+	for len(body) > 0 {
+		i := bytes.IndexByte(body, ':')
+		if i <= 0 {
+			return nil, errInvalidPayload
+		}
+		n, err := strconv.Atoi(string(body[:i]))
+		if err != nil || n < 0 {
+			return nil, errInvalidPayload
+		}
+		body = body[i+1:]
+		end := 0
+		for units := 0; units < n; {
+			if end >= len(body) {
+				return nil, errInvalidPayload
+			}
+			r, size := utf8.DecodeRune(body[end:])
+			units += runeLen(r)
+			end += size
+		}
+		ret = append(ret, body[:end])
+		body = body[end:]
+	}
+	return ret, nil
+}
+
+func decodeBinaryPayload(body []byte) ([][]byte, error) {
+	var ret [][]byte
+	for len(body) > 0 {
+		if body[0] != stringFlag && body[0] != binaryFlag {
+			return nil, errInvalidPayload
+		}
+		n, i := 0, 1
+		for ; i < len(body) && body[i] != binarySeparator; i++ {
+			if body[i] > 9 {
+				return nil, errInvalidPayload
+			}
+			n = n*10 + int(body[i])
+		}
+		if i == 1 || i >= len(body) || len(body)-i-1 < n {
+			return nil, errInvalidPayload
+		}
+		body = body[i+1:]
+		ret = append(ret, body[:n])
+		body = body[n:]
+	}
+	return ret, nil
+}
+
+//utf16Len returns the length of b as a javascript string.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		n += runeLen(r)
+		b = b[size:]
+	}
+	return n
+}
+
+//runeLen returns the number of utf-16 code units of r.
+func runeLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,14 @@
+package polling
+
+import "github.com/webrtcn/go-socketio-client/transport"
+
+//Creater return polling creater
+var Creater = transport.Creater{
+	Name:      "polling",
+	Upgrading: false,
+	Client:    NewClient,
+}
+
+func init() {
+	transport.Register(Creater)
+}
@@ -0,0 +1,332 @@
+package polling
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/internal/proxytest"
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+func TestPayload(t *testing.T) {
+	Convey("Encode text packet", t, func() {
+		buf := bytes.NewBuffer(nil)
+		contentType, err := encodePacket(buf, packet{data: []byte("4测试")}, 3)
+		So(err, ShouldBeNil)
+		So(contentType, ShouldEqual, textContentType)
+		So(buf.String(), ShouldEqual, "3:4测试")
+	})
+
+	Convey("Encode binary packet", t, func() {
+		buf := bytes.NewBuffer(nil)
+		contentType, err := encodePacket(buf, packet{binary: true, data: []byte("\x04abcdefghij")}, 3)
+		So(err, ShouldBeNil)
+		So(contentType, ShouldEqual, binaryContentType)
+		So(buf.String(), ShouldEqual, "\x01\x01\x01\xff\x04abcdefghij")
+	})
+
+	Convey("Decode text payload", t, func() {
+		packets, err := decodePayload("text/plain; charset=UTF-8", []byte("3:4测试1:6"), 3)
+		So(err, ShouldBeNil)
+		So(len(packets), ShouldEqual, 2)
+		So(string(packets[0]), ShouldEqual, "4测试")
+		So(string(packets[1]), ShouldEqual, "6")
+
+		packets, err = decodePayload("text/plain", []byte("3:4\U0001F600"), 3)
+		So(err, ShouldBeNil)
+		So(string(packets[0]), ShouldEqual, "4\U0001F600")
+	})
+
+	Convey("Decode binary payload", t, func() {
+		packets, err := decodePayload(binaryContentType, []byte("\x00\x02\xff40\x01\x03\xff\x04\x01\x02"), 3)
+		So(err, ShouldBeNil)
+		So(len(packets), ShouldEqual, 2)
+		So(string(packets[0]), ShouldEqual, "40")
+		So(packets[1], ShouldResemble, []byte{4, 1, 2})
+	})
+
+	Convey("Engine.io v4 payload", t, func() {
+		buf := bytes.NewBuffer(nil)
+		contentType, err := encodePacket(buf, packet{binary: true, data: []byte("bAQI=")}, 4)
+		So(err, ShouldBeNil)
+		So(contentType, ShouldEqual, textContentType)
+		So(buf.String(), ShouldEqual, "bAQI=")
+
+		packets, err := decodePayload("text/plain", []byte("4hello\x1ebAQI=\x1e2"), 4)
+		So(err, ShouldBeNil)
+		So(len(packets), ShouldEqual, 3)
+		So(string(packets[0]), ShouldEqual, "4hello")
+		So(string(packets[1]), ShouldEqual, "bAQI=")
+		So(string(packets[2]), ShouldEqual, "2")
+	})
+
+	Convey("Decode invalid payload", t, func() {
+		_, err := decodePayload("text/plain", []byte("5:4ab"), 3)
+		So(err, ShouldEqual, errInvalidPayload)
+		_, err = decodePayload("text/plain", []byte("4ab"), 3)
+		So(err, ShouldEqual, errInvalidPayload)
+		_, err = decodePayload(binaryContentType, []byte("\x00\x09\xff40"), 3)
+		So(err, ShouldEqual, errInvalidPayload)
+	})
+}
+
+func TestPolling(t *testing.T) {
+	Convey("Creater", t, func() {
+		So(Creater.Name, ShouldEqual, "polling")
+		So(Creater.Client, ShouldNotBeNil)
+		registered, ok := transport.Get("polling")
+		So(ok, ShouldBeTrue)
+		So(registered.Name, ShouldEqual, "polling")
+	})
+
+	Convey("Handshake, read and write", t, func() {
+		var locker sync.Mutex
+		var posted, sids []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locker.Lock()
+			defer locker.Unlock()
+			if r.URL.Path != "/socket.io/" || r.URL.Query().Get("transport") != "polling" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.Method == "POST" {
+				b, _ := ioutil.ReadAll(r.Body)
+				posted = append(posted, string(b))
+				w.Write([]byte("ok"))
+				return
+			}
+			sids = append(sids, r.URL.Query().Get("sid"))
+			if len(sids) == 1 {
+				w.Write([]byte(`14:0{"sid":"abc"}2:40`))
+				return
+			}
+			w.Write([]byte("6:4hello"))
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest("GET", server.URL+"/socket.io/", nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, nil)
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(c.Response(), ShouldNotBeNil)
+
+		for _, expect := range []parser.PacketType{parser.OPEN, parser.MESSAGE, parser.MESSAGE} {
+			decoder, err := c.NextReader()
+			So(err, ShouldBeNil)
+			So(decoder.Type(), ShouldEqual, expect)
+		}
+
+		w, err := c.NextWriter(parser.MessageText, parser.MESSAGE)
+		So(err, ShouldBeNil)
+		w.Write([]byte("2[\"hi\"]"))
+		So(w.Close(), ShouldBeNil)
+		locker.Lock()
+		So(sids, ShouldResemble, []string{"", "abc"})
+		So(posted, ShouldResemble, []string{"8:42[\"hi\"]"})
+		locker.Unlock()
+	})
+
+	Convey("Base64 binary messages", t, func() {
+		var locker sync.Mutex
+		var posted, b64 []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locker.Lock()
+			defer locker.Unlock()
+			if r.Method == "POST" {
+				b, _ := ioutil.ReadAll(r.Body)
+				posted = append(posted, r.Header.Get("Content-Type")+" "+string(b))
+				w.Write([]byte("ok"))
+				return
+			}
+			b64 = append(b64, r.URL.Query().Get("b64"))
+			if len(b64) == 1 {
+				w.Write([]byte(`14:0{"sid":"abc"}`))
+				return
+			}
+			w.Write([]byte("6:b4AQI="))
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest("GET", server.URL+"/?b64=1", nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, nil)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		decoder, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.OPEN)
+		decoder, err = c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.MessageType(), ShouldEqual, parser.MessageBinary)
+		b, err := ioutil.ReadAll(decoder)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, []byte{1, 2})
+
+		w, err := c.NextWriter(parser.MessageBinary, parser.MESSAGE)
+		So(err, ShouldBeNil)
+		w.Write([]byte{3, 4})
+		So(w.Close(), ShouldBeNil)
+		locker.Lock()
+		So(b64, ShouldResemble, []string{"1", "1"})
+		So(posted, ShouldResemble, []string{"text/plain;charset=UTF-8 6:b4AwQ="})
+		locker.Unlock()
+	})
+
+	Convey("Handshake timeout", t, func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		start := time.Now()
+		_, err = NewClient(req, &transport.Options{HandshakeTimeout: 100 * time.Millisecond})
+		So(err, ShouldNotBeNil)
+		So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+	})
+}
+
+func TestPollingProxy(t *testing.T) {
+	Convey("Poll through http proxy", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`14:0{"sid":"abc"}`))
+		}))
+		defer server.Close()
+		var locker sync.Mutex
+		var proxied []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locker.Lock()
+			proxied = append(proxied, r.URL.Host)
+			locker.Unlock()
+			r.RequestURI = ""
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+		}))
+		defer proxy.Close()
+
+		proxyURL, err := url.Parse(proxy.URL)
+		So(err, ShouldBeNil)
+		serverURL, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, &transport.Options{Proxy: http.ProxyURL(proxyURL)})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		locker.Lock()
+		So(proxied, ShouldResemble, []string{serverURL.Host})
+		locker.Unlock()
+	})
+}
+
+func TestPollingSOCKS5(t *testing.T) {
+	Convey("Poll through socks5 proxy", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`14:0{"sid":"abc"}`))
+		}))
+		defer server.Close()
+		proxy := proxytest.NewSOCKS5()
+		defer proxy.Close()
+
+		serverURL, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, &transport.Options{Proxy: http.ProxyURL(proxy.URL)})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(proxy.Hosts(), ShouldResemble, []string{serverURL.Host})
+	})
+}
+
+//envProxy and envSecureProxy are HTTP_PROXY and HTTPS_PROXY of the tests,
+//set by TestMain before http.ProxyFromEnvironment reads them once.
+var envProxy, envSecureProxy *proxytest.Proxy
+
+func TestMain(m *testing.M) {
+	envProxy = proxytest.NewHTTP()
+	envSecureProxy = proxytest.NewHTTP()
+	os.Setenv("HTTP_PROXY", envProxy.URL.String())
+	os.Setenv("HTTPS_PROXY", envSecureProxy.URL.String())
+	os.Setenv("NO_PROXY", "bypass.test")
+	code := m.Run()
+	envProxy.Close()
+	envSecureProxy.Close()
+	os.Exit(code)
+}
+
+func TestPollingEnvironmentProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`14:0{"sid":"abc"}`))
+	})
+	poll := func(rawurl string, opts *transport.Options) error {
+		req, err := http.NewRequest("GET", rawurl, nil)
+		if err != nil {
+			return err
+		}
+		c, err := NewClient(req, opts)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+
+	Convey("Poll http through HTTP_PROXY", t, func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		envProxy.SetTarget(server.Listener.Addr().String())
+		So(poll("http://engine.test/", nil), ShouldBeNil)
+		So(envProxy.Hosts(), ShouldContain, "engine.test:80")
+	})
+
+	Convey("Poll https through HTTPS_PROXY", t, func() {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+		envSecureProxy.SetTarget(server.Listener.Addr().String())
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		opts := &transport.Options{
+			TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "example.com"},
+		}
+		So(poll("https://engine.test/", opts), ShouldBeNil)
+		So(envSecureProxy.Hosts(), ShouldContain, "engine.test:443")
+	})
+
+	Convey("Poll hosts of NO_PROXY directly", t, func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		proxied := len(envProxy.Hosts())
+		opts := &transport.Options{
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		}
+		So(poll("http://bypass.test/", opts), ShouldBeNil)
+		So(len(envProxy.Hosts()), ShouldEqual, proxied)
+	})
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/webrtcn/go-socketio-client/engineio"
+)
+
+//OverflowPolicy decides what Emit does when the send queue is full.
+type OverflowPolicy int
+
+//Overflow policies
+const (
+	OverflowBlock      OverflowPolicy = iota //wait for room, or until the context of the emit is done
+	OverflowFail                             //return ErrQueueFull
+	OverflowDropOldest                       //drop the oldest message to make room
+)
+
+var (
+	//ErrQueueFull is returned by Emit when the send queue is full.
+	ErrQueueFull = errors.New("send queue is full")
+	//ErrDropped is the error of a message dropped from the send queue, its
+	//ack gets it if the ack takes error first.
+	ErrDropped = errors.New("message dropped from the send queue")
+)
+
+//sendItem is a packet waiting in the send queue. done is called with the
+//result of writing it.
+type sendItem struct {
+	frames   []engineio.Message
+	compress bool
+	done     func(error)
+}
+
+//sendQueue is the bounded queue between Emit and the writer goroutine.
+type sendQueue struct {
+	locker    sync.Mutex
+	items     []*sendItem
+	size      int
+	policy    OverflowPolicy
+	highWater int
+	notEmpty  chan struct{}
+	notFull   chan struct{}
+}
+
+func newSendQueue(size int, policy OverflowPolicy) *sendQueue {
+	return &sendQueue{
+		size:     size,
+		policy:   policy,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+}
+
+//push appends item to the queue, following the overflow policy if it is full.
+func (q *sendQueue) push(ctx context.Context, item *sendItem) error {
+	for {
+		q.locker.Lock()
+		if len(q.items) < q.size {
+			q.append(item)
+			q.locker.Unlock()
+			return nil
+		}
+		switch q.policy {
+		case OverflowFail:
+			q.locker.Unlock()
+			return ErrQueueFull
+		case OverflowDropOldest:
+			oldest := q.items[0]
+			q.items = q.items[1:]
+			q.append(item)
+			q.locker.Unlock()
+			oldest.done(ErrDropped)
+			return nil
+		}
+		q.locker.Unlock()
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+//tryPush appends item to the queue, it returns false if the queue is full.
+func (q *sendQueue) tryPush(item *sendItem) bool {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	if len(q.items) >= q.size {
+		return false
+	}
+	q.append(item)
+	return true
+}
+
+func (q *sendQueue) append(item *sendItem) {
+	q.items = append(q.items, item)
+	if len(q.items) > q.highWater {
+		q.highWater = len(q.items)
+	}
+	signal(q.notEmpty)
+}
+
+//pop removes the first item of the queue, waiting for one until stop is
+//closed.
+func (q *sendQueue) pop(stop <-chan struct{}) (*sendItem, bool) {
+	for {
+		q.locker.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+			q.locker.Unlock()
+			signal(q.notFull)
+			return item, true
+		}
+		q.locker.Unlock()
+		select {
+		case <-q.notEmpty:
+		case <-stop:
+			return nil, false
+		}
+	}
+}
+
+//clear removes all items of the queue and fails them with err.
+func (q *sendQueue) clear(err error) {
+	q.locker.Lock()
+	items := q.items
+	q.items = nil
+	q.locker.Unlock()
+	signal(q.notFull)
+	for _, item := range items {
+		item.done(err)
+	}
+}
+
+func (q *sendQueue) depth() int {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	return len(q.items)
+}
+
+func (q *sendQueue) highWaterMark() int {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	return q.highWater
+}
+
+//signal wakes up a waiter of ch without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSendQueue(t *testing.T) {
+	newItem := func(results chan error) *sendItem {
+		return &sendItem{
+			done: func(err error) {
+				results <- err
+			},
+		}
+	}
+
+	Convey("Fail when full", t, func() {
+		q := newSendQueue(2, OverflowFail)
+		results := make(chan error, 3)
+		So(q.push(context.Background(), newItem(results)), ShouldBeNil)
+		So(q.push(context.Background(), newItem(results)), ShouldBeNil)
+		So(q.push(context.Background(), newItem(results)), ShouldEqual, ErrQueueFull)
+		So(q.depth(), ShouldEqual, 2)
+		So(q.highWaterMark(), ShouldEqual, 2)
+	})
+
+	Convey("Drop the oldest when full", t, func() {
+		q := newSendQueue(2, OverflowDropOldest)
+		dropped := make(chan error, 1)
+		kept := make(chan error, 2)
+		first := newItem(dropped)
+		So(q.push(context.Background(), first), ShouldBeNil)
+		second := newItem(kept)
+		So(q.push(context.Background(), second), ShouldBeNil)
+		third := newItem(kept)
+		So(q.push(context.Background(), third), ShouldBeNil)
+		So(<-dropped, ShouldEqual, ErrDropped)
+		item, ok := q.pop(nil)
+		So(ok, ShouldBeTrue)
+		So(item, ShouldEqual, second)
+		So(q.depth(), ShouldEqual, 1)
+		So(q.highWaterMark(), ShouldEqual, 2)
+	})
+
+	Convey("Block until there is room", t, func() {
+		q := newSendQueue(1, OverflowBlock)
+		results := make(chan error, 2)
+		So(q.push(context.Background(), newItem(results)), ShouldBeNil)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		So(q.push(ctx, newItem(results)), ShouldEqual, context.DeadlineExceeded)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			q.pop(nil)
+		}()
+		So(q.push(context.Background(), newItem(results)), ShouldBeNil)
+		So(q.depth(), ShouldEqual, 1)
+
+		stop := make(chan struct{})
+		close(stop)
+		q.clear(ErrClosed)
+		So(<-results, ShouldEqual, ErrClosed)
+		_, ok := q.pop(stop)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -1,94 +1,59 @@
 package client
 
 import (
-	"net/url"
+	"context"
+	"encoding/json"
+	"io"
 	"reflect"
 	"sync"
 	"time"
+
+	"github.com/webrtcn/go-socketio-client/engineio"
 )
 
 //Const fields for On methods
 const (
 	OnConnection      = "connection"
 	OnConnecting      = "connecting"
+	OnConnectError    = "connect_error"
 	OnDisConnection   = "disconnection"
 	OnMessage         = "message"
 	OnError           = "error"
 	OnReconnectFailed = "reconnect_failed"
+	OnPing            = "ping"
+	OnPong            = "pong"
 )
 
-//Socket socket.io client for golang
+//Socket is the socket of a namespace, with its own handlers and acks.
 type Socket struct {
-	sessionID  string
-	conn       *conn
-	uri        *url.URL
-	eventsLock sync.RWMutex
-	events     map[string]*caller
-	acks       map[int]*caller
-	id         int
-	namespace  string
-	options    *SocketOption
-	attempts   int
+	manager     *Manager
+	sessionID   string
+	eventsLock  sync.RWMutex
+	events      map[string]handler
+	acksLock    sync.Mutex
+	acks        map[int]*pendingAck
+	closeLock   sync.Mutex
+	closing     bool
+	writing     int
+	idle        chan struct{}
+	queue       *sendQueue
+	stopWriting chan struct{}
+	bufferLock  sync.Mutex
+	connected   bool
+	buffered    []*bufferedPacket
+	id          int
+	namespace   string
+	options     *SocketOption
 }
 
-//Connect to socketio server
+//Connect to socketio server, and returns the socket of the main namespace.
+//Join other namespaces over the same connection with s.Manager().Of.
 func Connect(uri string, options *SocketOption) (*Socket, error) {
-	u, err := url.Parse(uri)
+	m, err := NewManager(uri, options)
 	if err != nil {
 		return nil, err
 	}
-	if options == nil {
-		options = &SocketOption{
-			ReconnectionAttempts: 0,
-			ReconnectionDelay:    5,
-		}
-	}
-	c := &Socket{
-		uri:     u,
-		events:  make(map[string]*caller),
-		acks:    make(map[int]*caller),
-		options: options,
-	}
-	go c.connect()
-	return c, nil
-}
-
-func (client *Socket) connect() {
-	for {
-		if client.conn != nil && client.conn.askForClosed {
-			client.attempts = 0
-			break
-		}
-		if client.options.ReconnectionAttempts > 0 {
-			if client.attempts > client.options.ReconnectionAttempts {
-				p := packet{
-					Type: _RECONNECT_FAILED,
-					Id:   -1,
-				}
-				client.onPacket(nil, &p)
-				break
-			} else {
-				client.attempts++
-			}
-		}
-		p := packet{
-			Type: _CONNECTING,
-			Id:   -1,
-		}
-		client.onPacket(nil, &p)
-		socket, err := newConn(client.uri)
-		if err != nil {
-			if client.options.ReconnectionDelay <= 0 {
-				client.options.ReconnectionDelay = 5
-			}
-			time.Sleep(time.Duration(client.options.ReconnectionDelay) * time.Second)
-		} else {
-			client.conn = socket
-			client.attempts = 0
-			go client.readLoop()
-			break
-		}
-	}
+	return m.Of("/"), nil
 }
 
 //On get message from server
@@ -97,21 +62,55 @@ func (client *Socket) On(message string, fn interface{}) error {
 	if err != nil {
 		return err
 	}
+	client.handle(message, c)
+	return err
+}
+
+func (client *Socket) handle(message string, h handler) {
 	client.eventsLock.Lock()
-	client.events[message] = c
+	client.events[message] = h
 	client.eventsLock.Unlock()
-	return err
 }
 
 //Emit send message to server
 func (client *Socket) Emit(method string, args ...interface{}) error {
+	return client.emit(context.Background(), defaultFlags, method, args)
+}
+
+//EmitContext is Emit whose write is canceled when ctx is done. If a frame is
+//left half-written, the connection is closed.
+func (client *Socket) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	return client.emit(ctx, defaultFlags, method, args)
+}
+
+//Volatile returns an Emitter whose messages are dropped, instead of buffered
+//or waiting, when the socket is not connected or the connection is busy.
+//Acks of dropped messages get ErrDropped, if they take error first.
+func (client *Socket) Volatile() *Emitter {
+	return newEmitter(client).Volatile()
+}
+
+//Compress returns an Emitter whose messages are compressed or not, when
+//compression is enabled.
+func (client *Socket) Compress(compress bool) *Emitter {
+	return newEmitter(client).Compress(compress)
+}
+
+func (client *Socket) emit(ctx context.Context, flags emitFlags, method string, args []interface{}) error {
+	if !client.beginWrite() {
+		return ErrClosed
+	}
 	var c *caller
 	if l := len(args); l > 0 {
 		fv := reflect.ValueOf(args[l-1])
 		if fv.Kind() == reflect.Func {
 			var err error
 			c, err = newCaller(args[l-1])
+			if err == nil && flags.timeout > 0 && !newPendingAck(c).errFirst {
+				err = errAckNeedsError
+			}
 			if err != nil {
+				client.endWrite()
 				return err
 			}
 			args = args[:l-1]
@@ -119,14 +118,20 @@ func (client *Socket) Emit(method string, args ...interface{}) error {
 	}
 	args = append([]interface{}{method}, args...)
 	if c != nil {
-		id, err := client.sendID(args)
-		if err != nil {
-			return err
-		}
-		client.acks[id] = c
-		return nil
+		_, err := client.sendID(ctx, flags, args, newPendingAck(c))
+		return err
 	}
-	return client.send(args)
+	return client.send(ctx, flags, args)
+}
+
+//Manager returns the manager of the connection of the socket.
+func (client *Socket) Manager() *Manager {
+	return client.manager
+}
+
+//Namespace returns the namespace of the socket, such as "/" or "/chat".
+func (client *Socket) Namespace() string {
+	return namespaceName(client.namespace)
 }
 
 //GetSessionID get the current session id
@@ -134,24 +139,64 @@ func (client *Socket) GetSessionID() string {
 	return client.sessionID
 }
 
-//Close close connection
-func (client *Socket) Close() error {
-	client.conn.askForClosed = true
-	return client.conn.Close()
+//Handshake returns the engine.io handshake of the current connection.
+func (client *Socket) Handshake() Handshake {
+	conn := client.getConn()
+	if conn == nil {
+		return Handshake{}
+	}
+	return conn.Handshake()
 }
 
-func (client *Socket) send(args []interface{}) error {
+//QueueDepth returns the number of messages in the send queue.
+func (client *Socket) QueueDepth() int {
+	if client.queue == nil {
+		return 0
+	}
+	return client.queue.depth()
+}
+
+//QueueHighWaterMark returns the largest number of messages ever in the send
+//queue.
+func (client *Socket) QueueHighWaterMark() int {
+	if client.queue == nil {
+		return 0
+	}
+	return client.queue.highWaterMark()
+}
+
+func (client *Socket) getConn() *engineio.Session {
+	return client.manager.getConn()
+}
+
+//Latency returns the round trip time of the last heartbeat, measured from
+//PING to PONG. Engine.io v4 servers send PING themselves, so the client can
+//not measure it and Latency is 0.
+func (client *Socket) Latency() time.Duration {
+	conn := client.getConn()
+	if conn == nil {
+		return 0
+	}
+	return conn.Latency()
+}
+
+func (client *Socket) send(ctx context.Context, flags emitFlags, args []interface{}) error {
 	packet := packet{
 		Type: _EVENT,
 		Id:   -1,
 		NSP:  client.namespace,
 		Data: args,
 	}
-	encoder := newEncoder(client.conn)
-	return encoder.Encode(packet)
+	return client.sendPacket(ctx, flags, packet, func(error) {
+		client.endWrite()
+	})
 }
 
-func (client *Socket) sendID(args []interface{}) (int, error) {
+//sendID sends the message with a new ack id. ack is registered before
+//sending, so that it is ready even if the server answers at once. It is
+//failed with the error if sending fails.
+func (client *Socket) sendID(ctx context.Context, flags emitFlags, args []interface{}, ack *pendingAck) (int, error) {
+	client.acksLock.Lock()
 	packet := packet{
 		Type: _EVENT,
 		Id:   client.id,
@@ -162,26 +207,201 @@ func (client *Socket) sendID(args []interface{}) (int, error) {
 	if client.id < 0 {
 		client.id = 0
 	}
-	encoder := newEncoder(client.conn)
-	err := encoder.Encode(packet)
+	if flags.timeout > 0 {
+		ack.timer = time.AfterFunc(flags.timeout, func() {
+			client.failAck(packet.Id, ErrAckTimeout)
+		})
+	}
+	client.acks[packet.Id] = ack
+	client.acksLock.Unlock()
+	err := client.sendPacket(ctx, flags, packet, func(err error) {
+		if err != nil {
+			client.failAck(packet.Id, err)
+		}
+		client.endWrite()
+	})
 	if err != nil {
-		return -1, nil
+		return -1, err
 	}
 	return packet.Id, nil
 }
 
+//sendPacket writes the packet, or queues it for writeLoop if the send queue
+//is enabled. The packet is buffered while disconnected. done is called with
+//the result of writing it, volatile packets which are dropped are not errors.
+func (client *Socket) sendPacket(ctx context.Context, flags emitFlags, p packet, done func(error)) error {
+	buffered, err := client.bufferPacket(ctx, flags, p, done)
+	if buffered {
+		if err != nil {
+			done(err)
+		}
+	} else {
+		err = client.sendConnected(ctx, flags, p, done)
+	}
+	if flags.volatile && err == ErrDropped {
+		return nil
+	}
+	return err
+}
+
+//sendConnected is sendPacket when connected.
+func (client *Socket) sendConnected(ctx context.Context, flags emitFlags, p packet, done func(error)) error {
+	if client.queue == nil {
+		err := client.writePacket(ctx, flags, p)
+		if flags.volatile && (err == engineio.ErrBusy || err == io.EOF) {
+			err = ErrDropped
+		}
+		done(err)
+		return err
+	}
+	frames, err := encodeFrames(p)
+	if conn := client.getConn(); err == nil && conn != nil {
+		err = conn.CheckPayload(frames)
+	}
+	if err == nil {
+		item := &sendItem{
+			frames:   frames,
+			compress: flags.compress,
+			done:     done,
+		}
+		if !flags.volatile {
+			err = client.queue.push(ctx, item)
+		} else if !client.queue.tryPush(item) {
+			err = ErrDropped
+		}
+	}
+	if err != nil {
+		done(err)
+	}
+	return err
+}
+
+//writeLoop writes the packets of the send queue until Close.
+func (client *Socket) writeLoop() {
+	for {
+		item, ok := client.queue.pop(client.stopWriting)
+		if !ok {
+			return
+		}
+		item.done(client.writeFrames(context.Background(), item.frames, item.compress, true))
+	}
+}
+
+//sendConnect sends CONNECT packet to the namespace, which is required by
+//socket.io v5 servers even for the main namespace. The auth payload is sent
+//with it.
+func (client *Socket) sendConnect() error {
+	packet := packet{
+		Type: _CONNECT,
+		Id:   -1,
+		NSP:  client.namespace,
+	}
+	if auth := client.options.auth(client.Namespace()); auth != nil {
+		packet.Data = auth
+	}
+	return client.writePacket(context.Background(), defaultFlags, packet)
+}
+
+//Reconnect sends CONNECT packet to the namespace again, such as after the
+//server refused it with a ConnectError. A new auth payload is taken from
+//AuthFunc. The namespace is connected again with the connection anyway, if
+//the connection is lost.
+func (client *Socket) Reconnect() error {
+	if client.isClosing() {
+		return ErrClosed
+	}
+	if client.getConn() == nil {
+		return nil
+	}
+	return client.manager.sendConnect(client)
+}
+
+//writePacket encodes the packet and writes it to the connection, within the
+//WriteTimeout option.
+func (client *Socket) writePacket(ctx context.Context, flags emitFlags, p packet) error {
+	frames, err := encodeFrames(p)
+	if err != nil {
+		return err
+	}
+	return client.writeFrames(ctx, frames, flags.compress, !flags.volatile)
+}
+
+//writeFrames writes the frames of a packet to the connection.
+func (client *Socket) writeFrames(ctx context.Context, frames []engineio.Message, compress, wait bool) error {
+	conn := client.getConn()
+	if conn == nil {
+		return io.EOF
+	}
+	return conn.Write(ctx, frames, engineio.WriteFlags{
+		NoCompress: !compress,
+		NoWait:     !wait,
+	})
+}
+
+//onDisconnect fails the pending acks with ErrDisconnected, and fires
+//OnDisConnection with the reason, if the namespace is connected. Acks of the
+//packets in the send buffer are kept, they are sent once connected again.
+func (client *Socket) onDisconnect(reason DisconnectReason, err error) {
+	if client.setDisconnected() {
+		client.failAcks(ErrDisconnected, client.bufferedAcks())
+		client.fire(OnDisConnection, reason, err)
+	}
+}
+
+//fire calls the handler of a local event with args.
+func (client *Socket) fire(message string, args ...interface{}) {
+	client.eventsLock.RLock()
+	c, ok := client.events[message]
+	client.eventsLock.RUnlock()
+	if !ok {
+		return
+	}
+	c.fire(args)
+}
+
 func (client *Socket) onAck(id int, decoder *decoder, packet *packet) error {
-	c, ok := client.acks[id]
+	a, ok := client.takeAck(id)
 	if !ok {
+		decoder.Close()
+		return nil
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.reply != nil {
+		args, binary, err := decoder.DecodeRaw(packet)
+		if err != nil {
+			a.reply(Ack{}, err)
+			return err
+		}
+		a.reply(Ack{args: args, binary: binary}, nil)
 		return nil
 	}
-	delete(client.acks, id)
-	args := c.GetArgs()
-	packet.Data = &args
+	args := a.caller.GetArgs()
+	data := args
+	if a.errFirst { //the error is nil
+		data = args[1:]
+	}
+	packet.Data = &data
+	if err := decoder.DecodeData(packet); err != nil {
+		return err
+	}
+	a.caller.Call(args)
+	return nil
+}
+
+//onConnectError fires OnConnectError with the ConnectError sent by the
+//server, and OnError with its message. The namespace is not connected again
+//until Reconnect is called or the connection is lost.
+func (client *Socket) onConnectError(decoder *decoder, packet *packet) error {
+	var raw json.RawMessage
+	packet.Data = &raw
 	if err := decoder.DecodeData(packet); err != nil {
 		return err
 	}
-	c.Call(args)
+	err := decodeConnectError(packet.NSP, raw)
+	client.fire(OnConnectError, err)
+	client.fire(OnError, err.Message)
 	return nil
 }
 
@@ -189,18 +409,26 @@ func (client *Socket) onPacket(decoder *decoder, packet *packet) ([]interface{},
 	var message string
 	switch packet.Type {
 	case _CONNECT:
-		client.sessionID = client.conn.sessionid
+		if conn := client.getConn(); conn != nil {
+			client.sessionID = conn.ID()
+		}
+		var info struct {
+			SessionID string `json:"sid"`
+		}
+		packet.Data = &info
+		if err := decoder.DecodeData(packet); err != nil {
+			return nil, err
+		}
+		if info.SessionID != "" {
+			client.sessionID = info.SessionID
+		}
+		client.flushBuffer()
 		message = "connection"
-	case _CONNECTING:
-		message = "connecting"
-	case _RECONNECT_FAILED:
-		message = "reconnect_failed"
-	case _DISCONNECT:
-		message = "disconnection"
-		go client.connect()
+	case _DISCONNECT: //handled by readLoop
+		decoder.Close()
+		return nil, nil
 	case _ERROR:
-		message = "error"
-		go client.connect()
+		return nil, client.onConnectError(decoder, packet)
 	case _ACK:
 		fallthrough
 	case _BINARY_ACK:
@@ -215,73 +443,5 @@ func (client *Socket) onPacket(decoder *decoder, packet *packet) ([]interface{},
 		decoder.Close()
 		return nil, nil
 	}
-	args := c.GetArgs()
-	olen := len(args)
-	if olen > 0 {
-		packet.Data = &args
-		if err := decoder.DecodeData(packet); err != nil {
-			return nil, err
-		}
-	}
-	for i := len(args); i < olen; i++ {
-		args = append(args, nil)
-	}
-
-	retV := c.Call(args)
-	if len(retV) == 0 {
-		return nil, nil
-	}
-
-	var err error
-	if last, ok := retV[len(retV)-1].Interface().(error); ok {
-		err = last
-		retV = retV[0 : len(retV)-1]
-	}
-	ret := make([]interface{}, len(retV))
-	for i, v := range retV {
-		ret[i] = v.Interface()
-	}
-	return ret, err
-}
-
-func (client *Socket) readLoop() error {
-	defer func() {
-		p := packet{
-			Type: _DISCONNECT,
-			Id:   -1,
-		}
-		client.onPacket(nil, &p)
-	}()
-	for {
-		decoder := newDecoder(client.conn)
-		var p packet
-		if err := decoder.Decode(&p); err != nil {
-			return err
-		}
-		ret, err := client.onPacket(decoder, &p)
-		if err != nil {
-			return err
-		}
-		switch p.Type {
-		case _CONNECT:
-			client.namespace = p.NSP
-		case _BINARY_EVENT:
-			fallthrough
-		case _EVENT:
-			if p.Id >= 0 {
-				p := packet{
-					Type: _ACK,
-					Id:   p.Id,
-					NSP:  client.namespace,
-					Data: ret,
-				}
-				encoder := newEncoder(client.conn)
-				if err := encoder.Encode(p); err != nil {
-					return err
-				}
-			}
-		case _DISCONNECT:
-			return nil
-		}
-	}
+	return c.call(decoder, packet)
 }
@@ -1,7 +1,118 @@
 package client
 
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/webrtcn/go-socketio-client/engineio"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+//Protocol versions of engine.io
+const (
+	ProtocolV3 = 3 // engine.io v3, socket.io v2 servers
+	ProtocolV4 = 4 // engine.io v4, socket.io v3 and v4 servers
+)
+
 //SocketOption options
 type SocketOption struct {
 	ReconnectionAttempts int
-	ReconnectionDelay    int // how long to reconnect.  default value 5.
+	ReconnectionDelay    int  // how long to reconnect.  default value 5.
+	Upgrade              bool // connect with polling first, then upgrade to websocket when the server allows.
+	ProtocolVersion      int  // ProtocolV3 or ProtocolV4. default value ProtocolV3.
+	// Transports is the names of registered transports, tried in order until one connects.
+	// default value {"websocket"}, or {"polling", "websocket"} when Upgrade is set.
+	Transports []string
+
+	TLSClientConfig  *tls.Config   // root CAs, client certificates and server name of TLS connections.
+	HandshakeTimeout time.Duration // default value 45 seconds.
+	WriteTimeout     time.Duration // time limit of writing each packet, no limit of messages if 0.
+	ReadBufferSize   int           // read buffer size of the connection.
+	WriteBufferSize  int           // write buffer size of the connection.
+	// NetDialContext dials the network connections of the transports, when set. It can return any
+	// net.Conn, such as an in-process pipe. The polling transport may dial more than one connection.
+	// Urls like unix:///run/app.sock:/realtime/ connect to the unix socket /run/app.sock instead.
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Proxy returns the proxy of a request, http CONNECT and socks5 proxies are supported.
+	// Use http.ProxyURL for a fixed proxy, credentials of basic auth are taken from the url.
+	// default value http.ProxyFromEnvironment, which reads HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	Header http.Header    // extra headers of handshake requests, such as Authorization and User-Agent.
+	Query  url.Values     // extra query parameters of handshake requests.
+	Path   string         // path of the server, default value "/socket.io/".
+	Jar    http.CookieJar // keeps cookies, such as load balancer affinity cookies, across reconnects.
+	// Auth is sent with the CONNECT packet of every namespace, where the middlewares of socket.io v3
+	// and v4 servers read it as socket.handshake.auth. socket.io v2 servers take Query instead.
+	Auth map[string]interface{}
+	// AuthFunc returns the auth of each CONNECT packet of namespace nsp, such as a fresh token,
+	// instead of Auth.
+	AuthFunc func(nsp string) map[string]interface{}
+
+	EnableCompression    bool // compress websocket messages with permessage-deflate.
+	CompressionLevel     int  // flate compression level, default value 1.
+	CompressionThreshold int  // messages smaller than it are not compressed.
+	// ForceBase64 sends binary attachments as base64 text, for servers or proxies which only pass text.
+	ForceBase64 bool
+
+	// SendQueueSize is the number of messages queued for a writer goroutine, Emit returns once the
+	// message is queued. default value 0, Emit writes the message itself.
+	SendQueueSize   int
+	SendQueuePolicy OverflowPolicy // what Emit does when the queue is full, default value OverflowBlock.
+
+	// SendBufferSize is the number of messages emitted while disconnected which are kept, and sent in
+	// order once connected. default value 100, Emit returns ErrBufferFull when it is full.
+	SendBufferSize int
+	SendBufferTTL  time.Duration // buffered messages older than it are dropped, default value 0, no limit.
+}
+
+func (o *SocketOption) protocolVersion() int {
+	if o.ProtocolVersion == ProtocolV4 {
+		return ProtocolV4
+	}
+	return ProtocolV3
+}
+
+func (o *SocketOption) auth(nsp string) map[string]interface{} {
+	if o.protocolVersion() < ProtocolV4 {
+		return nil
+	}
+	if o.AuthFunc != nil {
+		return o.AuthFunc(nsp)
+	}
+	return o.Auth
+}
+
+func (o *SocketOption) engineOptions() *engineio.Options {
+	return &engineio.Options{
+		ProtocolVersion: o.protocolVersion(),
+		Upgrade:         o.Upgrade,
+		Transports:      o.Transports,
+		Header:          o.Header,
+		Query:           o.Query,
+		ForceBase64:     o.ForceBase64,
+		WriteTimeout:    o.WriteTimeout,
+		Transport:       o.transportOptions(),
+	}
+}
+
+func (o *SocketOption) transportOptions() transport.Options {
+	return transport.Options{
+		TLSClientConfig:  o.TLSClientConfig,
+		HandshakeTimeout: o.HandshakeTimeout,
+		ReadBufferSize:   o.ReadBufferSize,
+		WriteBufferSize:  o.WriteBufferSize,
+		NetDialContext:   o.NetDialContext,
+		Proxy:            o.Proxy,
+		Path:             o.Path,
+		Jar:              o.Jar,
+
+		EnableCompression:    o.EnableCompression,
+		CompressionLevel:     o.CompressionLevel,
+		CompressionThreshold: o.CompressionThreshold,
+	}
 }
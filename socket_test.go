@@ -0,0 +1,694 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/memory"
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
+)
+
+//newTestSocket connects a socket to a fake engine.io server in memory.
+func newTestSocket(name string, options *SocketOption) (*Socket, *memory.Session, *memory.Server) {
+	s, session, server := dialTestSocket(name, options)
+	So(session.Open("s1", time.Minute, time.Minute), ShouldBeNil)
+	return s, session, server
+}
+
+//dialTestSocket is newTestSocket without sending OPEN packet.
+func dialTestSocket(name string, options *SocketOption) (*Socket, *memory.Session, *memory.Server) {
+	server := memory.NewServer(name)
+	transport.Register(server.Creater())
+	if options == nil {
+		options = &SocketOption{}
+	}
+	options.Transports = []string{name}
+	s, err := Connect("http://localhost", options)
+	So(err, ShouldBeNil)
+	session, err := server.Accept()
+	So(err, ShouldBeNil)
+	return s, session, server
+}
+
+func TestSocket(t *testing.T) {
+	Convey("Connect and emit", t, func() {
+		s, session, server := newTestSocket("memory-socket-emit", nil)
+		defer server.Close()
+		connected := make(chan string, 1)
+		s.On(OnConnection, func() {
+			connected <- s.GetSessionID()
+		})
+		So(session.Message("0"), ShouldBeNil)
+		So(<-connected, ShouldEqual, "s1")
+
+		So(s.Emit("chat", "hi", 1), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat","hi",1]`), ShouldBeNil)
+
+		acked := make(chan string, 1)
+		So(s.Emit("query", map[string]int{"a": 1}, func(r string) {
+			acked <- r
+		}), ShouldBeNil)
+		So(session.ExpectMessage(`20["query",{"a":1}]`), ShouldBeNil)
+		So(session.Message(`30["ok"]`), ShouldBeNil)
+		So(<-acked, ShouldEqual, "ok")
+	})
+
+	Convey("Handle events and answer acks", t, func() {
+		s, session, server := newTestSocket("memory-socket-on", nil)
+		defer server.Close()
+		s.On("add", func(a, b int) int {
+			return a + b
+		})
+		So(session.Message("0"), ShouldBeNil)
+		So(session.Message(`21["add",1,2]`), ShouldBeNil)
+		So(session.ExpectMessage(`31[3]`), ShouldBeNil)
+	})
+
+	Convey("Binary attachments", t, func() {
+		s, session, server := newTestSocket("memory-socket-binary", nil)
+		defer server.Close()
+		received := make(chan string, 1)
+		s.On("file", func(a *Attachment) {
+			b, _ := ioutil.ReadAll(a.Data)
+			received <- string(b)
+		})
+		So(session.Message("0"), ShouldBeNil)
+		So(session.Message(`51-["file",{"_placeholder":true,"num":0}]`), ShouldBeNil)
+		So(session.SendBinary(parser.MESSAGE, []byte("abc")), ShouldBeNil)
+		So(<-received, ShouldEqual, "abc")
+
+		So(s.Emit("upload", &Attachment{Data: bytes.NewBufferString("xyz")}), ShouldBeNil)
+		So(session.ExpectMessage(`51-["upload",{"_placeholder":true,"num":0}]`), ShouldBeNil)
+		p, err := session.Read()
+		So(err, ShouldBeNil)
+		So(p.MessageType, ShouldEqual, parser.MessageBinary)
+		So(string(p.Data), ShouldEqual, "xyz")
+	})
+
+	Convey("Disconnect", t, func() {
+		s, session, server := newTestSocket("memory-socket-disconnect", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		disconnected := make(chan struct{}, 1)
+		s.On(OnDisConnection, func() {
+			disconnected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		session.Disconnect()
+		<-disconnected
+		_, err := server.Accept()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Handshake and max payload", t, func() {
+		s, session, server := dialTestSocket("memory-socket-handshake", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Send(parser.OPEN, `{"sid":"s2","upgrades":["websocket"],"pingInterval":60000,"pingTimeout":60000,"maxPayload":20}`), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(s.Handshake(), ShouldResemble, Handshake{
+			SessionID:    "s2",
+			Upgrades:     []string{"websocket"},
+			PingInterval: 60000,
+			PingTimeout:  60000,
+			MaxPayload:   20,
+		})
+
+		err := s.Emit("chat", "a message too large")
+		So(err, ShouldHaveSameTypeAs, &PayloadTooLargeError{})
+		So(err.(*PayloadTooLargeError).MaxPayload, ShouldEqual, 20)
+		So(s.Emit("chat", "hi"), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat","hi"]`), ShouldBeNil)
+	})
+}
+
+func TestSocketHeartbeat(t *testing.T) {
+	Convey("Measure the round trip time of PING", t, func() {
+		s, session, server := dialTestSocket("memory-socket-heartbeat", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		pinged := make(chan struct{}, 1)
+		ponged := make(chan time.Duration, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		s.On(OnPing, func() {
+			pinged <- struct{}{}
+		})
+		s.On(OnPong, func(rtt time.Duration) {
+			ponged <- rtt
+		})
+		So(session.Open("s1", 50*time.Millisecond, time.Second), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+
+		So(session.Expect(parser.PING, ""), ShouldBeNil)
+		<-pinged
+		time.Sleep(20 * time.Millisecond)
+		So(session.Send(parser.PONG, ""), ShouldBeNil)
+		rtt := <-ponged
+		So(rtt, ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		So(s.Latency(), ShouldEqual, rtt)
+		So(s.Handshake().PingInterval, ShouldEqual, 50)
+		So(s.Handshake().PingTimeout, ShouldEqual, 1000)
+	})
+}
+
+func TestSocketDisconnectReason(t *testing.T) {
+	type disconnect struct {
+		reason DisconnectReason
+		err    error
+	}
+	tests := []struct {
+		name   string
+		cut    func(s *Socket, session *memory.Session)
+		reason DisconnectReason
+		hasErr bool
+	}{
+		{"server disconnect", func(s *Socket, session *memory.Session) {
+			session.Message("1")
+		}, ReasonServerDisconnect, false},
+		{"client close", func(s *Socket, session *memory.Session) {
+			s.Close(context.Background())
+		}, ReasonClientClose, false},
+		{"transport close", func(s *Socket, session *memory.Session) {
+			session.Close()
+		}, ReasonTransportClose, false},
+		{"transport error", func(s *Socket, session *memory.Session) {
+			session.Disconnect()
+		}, ReasonTransportError, true},
+		{"parse error", func(s *Socket, session *memory.Session) {
+			session.Message("2[broken")
+		}, ReasonParseError, true},
+	}
+	for i, test := range tests {
+		Convey("Disconnect with "+test.name, t, func() {
+			s, session, server := newTestSocket(fmt.Sprintf("memory-socket-reason-%d", i), &SocketOption{ReconnectionDelay: 1})
+			defer server.Close()
+			connected := make(chan struct{}, 1)
+			disconnected := make(chan disconnect, 1)
+			s.On(OnConnection, func() {
+				connected <- struct{}{}
+			})
+			s.On(OnDisConnection, func(reason DisconnectReason, err error) {
+				disconnected <- disconnect{reason, err}
+			})
+			So(session.Message("0"), ShouldBeNil)
+			<-connected
+			test.cut(s, session)
+			d := <-disconnected
+			So(d.reason, ShouldEqual, test.reason)
+			So(d.err != nil, ShouldEqual, test.hasErr)
+		})
+	}
+
+	Convey("Disconnect with ping timeout", t, func() {
+		s, session, server := dialTestSocket("memory-socket-reason-ping", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		disconnected := make(chan DisconnectReason, 1)
+		s.On(OnDisConnection, func(reason DisconnectReason) {
+			disconnected <- reason
+		})
+		So(session.Open("s1", 20*time.Millisecond, 20*time.Millisecond), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		So(<-disconnected, ShouldEqual, ReasonPingTimeout)
+		So(ReasonPingTimeout.String(), ShouldEqual, "ping timeout")
+	})
+}
+
+func TestSocketClose(t *testing.T) {
+	Convey("Close waits for pending acks", t, func() {
+		s, session, server := newTestSocket("memory-socket-close", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		acked := make(chan string, 1)
+		So(s.Emit("query", func(r string) {
+			acked <- r
+		}), ShouldBeNil)
+		So(session.ExpectMessage(`20["query"]`), ShouldBeNil)
+
+		type result struct {
+			summary CloseSummary
+			err     error
+		}
+		closed := make(chan result, 1)
+		go func() {
+			summary, err := s.Close(context.Background())
+			closed <- result{summary, err}
+		}()
+		time.Sleep(20 * time.Millisecond)
+		So(s.Emit("chat", "late"), ShouldEqual, ErrClosed)
+		So(session.Message(`30["ok"]`), ShouldBeNil)
+		So(<-acked, ShouldEqual, "ok")
+		r := <-closed
+		So(r.err, ShouldBeNil)
+		So(r.summary.PendingWrites, ShouldEqual, 0)
+		So(r.summary.PendingAcks, ShouldBeEmpty)
+		So(session.ExpectMessage("1"), ShouldBeNil)
+		So(session.Expect(parser.CLOSE, ""), ShouldBeNil)
+	})
+
+	Convey("Close abandons acks at the deadline", t, func() {
+		s, session, server := newTestSocket("memory-socket-close-deadline", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(s.Emit("query", func(r string) {}), ShouldBeNil)
+		So(s.Emit("query", func(r string) {}), ShouldBeNil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		summary, err := s.Close(ctx)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(summary.PendingAcks, ShouldResemble, []int{0, 1})
+		So(summary.DisconnectUnsent, ShouldBeTrue)
+		So(session.ExpectMessage(`20["query"]`), ShouldBeNil)
+		So(session.ExpectMessage(`21["query"]`), ShouldBeNil)
+		_, err = session.Read()
+		So(err, ShouldEqual, io.EOF)
+	})
+
+	Convey("Close returns at the deadline when the writer stalls", t, func() {
+		s, session, server := newTestSocket("memory-socket-close-stalled", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		for i := 0; i < 64; i++ { //fill the buffer of the pipe
+			So(s.Emit("chat", i), ShouldBeNil)
+		}
+		stalled := make(chan error, 1)
+		go func() {
+			stalled <- s.Emit("chat", "stalled")
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		summary, err := s.Close(ctx)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(summary.PendingWrites, ShouldEqual, 1)
+		So(summary.DisconnectUnsent, ShouldBeTrue)
+		So(<-stalled, ShouldNotBeNil)
+	})
+}
+
+func TestSocketWriteTimeout(t *testing.T) {
+	Convey("A stalled write times out and closes the connection", t, func() {
+		s, session, server := newTestSocket("memory-socket-write-timeout", &SocketOption{
+			ReconnectionDelay: 1,
+			WriteTimeout:      20 * time.Millisecond,
+		})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		disconnected := make(chan error, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		s.On(OnDisConnection, func(reason DisconnectReason, err error) {
+			if reason == ReasonTransportError {
+				disconnected <- err
+			}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		for i := 0; i < 64; i++ { //fill the buffer of the pipe
+			So(s.Emit("chat", i), ShouldBeNil)
+		}
+		So(s.Emit("chat", "stalled"), ShouldEqual, context.DeadlineExceeded)
+		So(<-disconnected, ShouldEqual, context.DeadlineExceeded)
+	})
+
+	Convey("EmitContext returns when ctx is canceled", t, func() {
+		s, session, server := newTestSocket("memory-socket-emit-context", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		So(s.EmitContext(ctx, "chat", "hi"), ShouldEqual, context.Canceled)
+		So(s.EmitContext(context.Background(), "chat", "hi"), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat","hi"]`), ShouldBeNil)
+	})
+}
+
+func TestSocketSendQueue(t *testing.T) {
+	Convey("Emit queues messages for the writer", t, func() {
+		s, session, server := newTestSocket("memory-socket-queue", &SocketOption{
+			ReconnectionDelay: 1,
+			SendQueueSize:     2,
+		})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		//64 messages in the pipe, 1 being written and 2 in the queue
+		for i := 0; i < 67; i++ {
+			So(s.Emit("chat", i), ShouldBeNil)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		So(s.EmitContext(ctx, "chat", "full"), ShouldEqual, context.DeadlineExceeded)
+		So(s.QueueDepth(), ShouldEqual, 2)
+		So(s.QueueHighWaterMark(), ShouldEqual, 2)
+
+		for i := 0; i < 67; i++ {
+			So(session.ExpectMessage(fmt.Sprintf(`2["chat",%d]`, i)), ShouldBeNil)
+		}
+		So(s.QueueDepth(), ShouldEqual, 0)
+	})
+}
+
+func TestSocketSendBuffer(t *testing.T) {
+	Convey("Emits before connecting are sent in order once connected", t, func() {
+		s, session, server := dialTestSocket("memory-socket-buffer", &SocketOption{
+			ReconnectionDelay: 1,
+			SendBufferSize:    2,
+		})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		acked := make(chan string, 1)
+		So(s.Emit("first"), ShouldBeNil)
+		So(s.Emit("second", func(r string) {
+			acked <- r
+		}), ShouldBeNil)
+		So(s.Emit("third"), ShouldEqual, ErrBufferFull)
+
+		So(session.Open("s1", time.Minute, time.Minute), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(s.Emit("after"), ShouldBeNil)
+		So(session.ExpectMessage(`2["first"]`), ShouldBeNil)
+		So(session.ExpectMessage(`20["second"]`), ShouldBeNil)
+		So(session.ExpectMessage(`2["after"]`), ShouldBeNil)
+		So(session.Message(`30["ok"]`), ShouldBeNil)
+		So(<-acked, ShouldEqual, "ok")
+	})
+
+	Convey("Emits while reconnecting are flushed after reconnect", t, func() {
+		s, session, server := newTestSocket("memory-socket-buffer-reconnect", &SocketOption{
+			ReconnectionDelay: 1,
+			SendBufferTTL:     time.Minute,
+		})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		disconnected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		s.On(OnDisConnection, func() {
+			disconnected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		session.Disconnect()
+		<-disconnected
+		So(s.Emit("offline"), ShouldBeNil)
+
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s2", time.Minute, time.Minute), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(session.ExpectMessage(`2["offline"]`), ShouldBeNil)
+	})
+
+	Convey("Expired emits are dropped", t, func() {
+		s, session, server := dialTestSocket("memory-socket-buffer-ttl", &SocketOption{
+			ReconnectionDelay: 1,
+			SendBufferTTL:     10 * time.Millisecond,
+		})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(s.Emit("old"), ShouldBeNil)
+		time.Sleep(30 * time.Millisecond)
+		So(s.Emit("new"), ShouldBeNil)
+		So(session.Open("s1", time.Minute, time.Minute), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(session.ExpectMessage(`2["new"]`), ShouldBeNil)
+	})
+}
+
+func TestSocketVolatile(t *testing.T) {
+	Convey("Volatile emits are dropped while disconnected or busy", t, func() {
+		s, session, server := dialTestSocket("memory-socket-volatile", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(s.Volatile().Emit("cursor", 1), ShouldBeNil)
+		So(session.Open("s1", time.Minute, time.Minute), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+
+		for i := 0; i < 64; i++ { //fill the buffer of the pipe
+			So(s.Emit("chat", i), ShouldBeNil)
+		}
+		stalled := make(chan error, 1)
+		go func() {
+			stalled <- s.Emit("chat", "stalled")
+		}()
+		time.Sleep(20 * time.Millisecond)
+		So(s.Volatile().Emit("cursor", 2), ShouldBeNil)
+
+		for i := 0; i < 64; i++ {
+			So(session.ExpectMessage(fmt.Sprintf(`2["chat",%d]`, i)), ShouldBeNil)
+		}
+		So(session.ExpectMessage(`2["chat","stalled"]`), ShouldBeNil)
+		So(<-stalled, ShouldBeNil)
+		So(s.Volatile().Emit("cursor", 3), ShouldBeNil)
+		So(session.ExpectMessage(`2["cursor",3]`), ShouldBeNil)
+	})
+}
+
+func TestSocketConnectError(t *testing.T) {
+	Convey("Send auth and handle the refusal of the server", t, func() {
+		tokens := 0
+		s, session, server := newTestSocket("memory-socket-connect-error", &SocketOption{
+			ProtocolVersion: ProtocolV4,
+			AuthFunc: func(nsp string) map[string]interface{} {
+				tokens++
+				return map[string]interface{}{"token": fmt.Sprintf("%s%d", nsp, tokens)}
+			},
+		})
+		defer server.Close()
+		refused := make(chan *ConnectError, 1)
+		connected := make(chan struct{}, 1)
+		s.On(OnConnectError, func(err *ConnectError) {
+			refused <- err
+		})
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.ExpectMessage(`0{"token":"/1"}`), ShouldBeNil)
+		So(session.Message(`4{"message":"not authorized","data":{"code":401}}`), ShouldBeNil)
+		err := <-refused
+		So(err.Namespace, ShouldEqual, "")
+		So(err.Message, ShouldEqual, "not authorized")
+		So(string(err.Data), ShouldEqual, `{"code":401}`)
+		So(err.Error(), ShouldEqual, "connect to namespace /: not authorized")
+
+		So(s.Reconnect(), ShouldBeNil)
+		So(session.ExpectMessage(`0{"token":"/2"}`), ShouldBeNil)
+		So(session.Message(`0{"sid":"a"}`), ShouldBeNil)
+		<-connected
+	})
+
+	Convey("Socket.io v2 servers refuse with a string", t, func() {
+		s, session, server := newTestSocket("memory-socket-connect-error-v2", &SocketOption{
+			Auth: map[string]interface{}{"token": "ignored"},
+		})
+		defer server.Close()
+		admin := s.Manager().Of("/admin")
+		refused := make(chan *ConnectError, 1)
+		errored := make(chan string, 1)
+		admin.On(OnConnectError, func(err *ConnectError) {
+			refused <- err
+		})
+		admin.On(OnError, func(msg string) {
+			errored <- msg
+		})
+		So(session.ExpectMessage("0/admin"), ShouldBeNil)
+		So(session.Message(`4/admin,"forbidden"`), ShouldBeNil)
+		err := <-refused
+		So(err.Namespace, ShouldEqual, "/admin")
+		So(err.Message, ShouldEqual, "forbidden")
+		So(string(err.Data), ShouldEqual, "null")
+		So(<-errored, ShouldEqual, "forbidden")
+	})
+}
+
+func TestSocketAck(t *testing.T) {
+	type result struct {
+		err error
+		r   string
+	}
+	Convey("Acks of Timeout emits get ErrAckTimeout", t, func() {
+		s, session, server := newTestSocket("memory-socket-ack-timeout", nil)
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		acked := make(chan result, 2)
+		ack := func(err error, r string) {
+			acked <- result{err, r}
+		}
+		So(s.Timeout(time.Minute).Emit("query", ack), ShouldBeNil)
+		So(session.ExpectMessage(`20["query"]`), ShouldBeNil)
+		So(session.Message(`30["ok"]`), ShouldBeNil)
+		So(<-acked, ShouldResemble, result{nil, "ok"})
+
+		So(s.Timeout(20*time.Millisecond).Emit("query", ack), ShouldBeNil)
+		So(session.ExpectMessage(`21["query"]`), ShouldBeNil)
+		So(<-acked, ShouldResemble, result{ErrAckTimeout, ""})
+		So(session.Message(`31["late"]`), ShouldBeNil)
+		So(s.Emit("chat"), ShouldBeNil)
+		So(session.ExpectMessage(`2["chat"]`), ShouldBeNil)
+		So(acked, ShouldBeEmpty)
+
+		So(s.Timeout(time.Second).Emit("query", func(r string) {}), ShouldNotBeNil)
+	})
+
+	Convey("Pending acks fail when disconnected", t, func() {
+		s, session, server := newTestSocket("memory-socket-ack-disconnect", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		disconnected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		s.On(OnDisConnection, func() {
+			disconnected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		acked := make(chan result, 2)
+		ack := func(err error, r string) {
+			acked <- result{err, r}
+		}
+		So(s.Emit("query", ack), ShouldBeNil)
+		So(s.Emit("legacy", func(r string) {}), ShouldBeNil)
+		So(session.ExpectMessage(`20["query"]`), ShouldBeNil)
+		So(session.ExpectMessage(`21["legacy"]`), ShouldBeNil)
+		session.Disconnect()
+		So(<-acked, ShouldResemble, result{ErrDisconnected, ""})
+		<-disconnected
+		_, acks := s.pending()
+		So(acks, ShouldBeEmpty)
+
+		So(s.Emit("offline", ack), ShouldBeNil)
+		session, err := server.Accept()
+		So(err, ShouldBeNil)
+		So(session.Open("s2", time.Minute, time.Minute), ShouldBeNil)
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		So(session.ExpectMessage(`22["offline"]`), ShouldBeNil)
+		So(session.Message(`32["back"]`), ShouldBeNil)
+		So(<-acked, ShouldResemble, result{nil, "back"})
+	})
+}
+
+func TestSocketEmitWithAck(t *testing.T) {
+	type result struct {
+		ack Ack
+		err error
+	}
+	Convey("EmitWithAck blocks until the ack", t, func() {
+		s, session, server := newTestSocket("memory-socket-emit-with-ack", &SocketOption{ReconnectionDelay: 1})
+		defer server.Close()
+		connected := make(chan struct{}, 1)
+		s.On(OnConnection, func() {
+			connected <- struct{}{}
+		})
+		So(session.Message("0"), ShouldBeNil)
+		<-connected
+		emit := func(ctx context.Context, args ...interface{}) chan result {
+			done := make(chan result, 1)
+			go func() {
+				ack, err := s.EmitWithAck(ctx, "query", args...)
+				done <- result{ack, err}
+			}()
+			return done
+		}
+
+		done := emit(context.Background(), 1, 2)
+		So(session.ExpectMessage(`20["query",1,2]`), ShouldBeNil)
+		So(session.Message(`30[3,"three"]`), ShouldBeNil)
+		r := <-done
+		So(r.err, ShouldBeNil)
+		So(r.ack.Len(), ShouldEqual, 2)
+		var sum int
+		var name string
+		So(r.ack.Decode(&sum, &name), ShouldBeNil)
+		So(sum, ShouldEqual, 3)
+		So(name, ShouldEqual, "three")
+
+		done = emit(context.Background())
+		So(session.ExpectMessage(`21["query"]`), ShouldBeNil)
+		So(session.Message(`61-1[{"_placeholder":true,"num":0}]`), ShouldBeNil)
+		So(session.SendBinary(parser.MESSAGE, []byte("abc")), ShouldBeNil)
+		r = <-done
+		So(r.err, ShouldBeNil)
+		var a Attachment
+		So(r.ack.Decode(&a), ShouldBeNil)
+		b, _ := ioutil.ReadAll(a.Data)
+		So(string(b), ShouldEqual, "abc")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		So((<-emit(ctx)).err, ShouldEqual, context.DeadlineExceeded)
+		So(session.ExpectMessage(`22["query"]`), ShouldBeNil)
+		So(session.Message(`32["late"]`), ShouldBeNil)
+
+		_, err := s.Timeout(20*time.Millisecond).EmitWithAck(context.Background(), "query")
+		So(err, ShouldEqual, ErrAckTimeout)
+		So(session.ExpectMessage(`23["query"]`), ShouldBeNil)
+
+		done = emit(context.Background())
+		So(session.ExpectMessage(`24["query"]`), ShouldBeNil)
+		session.Disconnect()
+		So((<-done).err, ShouldEqual, ErrDisconnected)
+	})
+}
@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//Options options used by transports to connect the server. A nil Options
+//uses the default values.
+type Options struct {
+	TLSClientConfig  *tls.Config
+	HandshakeTimeout time.Duration
+	ReadBufferSize   int
+	WriteBufferSize  int
+	NetDialContext   func(ctx context.Context, network, addr string) (net.Conn, error)
+	//Proxy returns the http or socks5 proxy of a request, nil uses
+	//http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+	//Path is the path of engine.io endpoint, which replaces the path of the
+	//request url. Empty path keeps the path of the request url.
+	Path string
+	//Jar stores the cookies of responses and sends them in requests.
+	Jar http.CookieJar
+	//EnableCompression negotiates permessage-deflate with the server.
+	EnableCompression bool
+	//CompressionLevel is the flate level of compressed messages, 0 uses the
+	//default level.
+	CompressionLevel int
+	//CompressionThreshold is the minimum size of compressed messages.
+	CompressionThreshold int
+}
@@ -0,0 +1,24 @@
+package transport
+
+import "sync"
+
+var (
+	creatersLocker sync.RWMutex
+	creaters       = make(map[string]Creater)
+)
+
+//Register makes the transport c available by its name. A transport registered
+//with the same name is replaced.
+func Register(c Creater) {
+	creatersLocker.Lock()
+	defer creatersLocker.Unlock()
+	creaters[c.Name] = c
+}
+
+//Get returns the transport registered with name.
+func Get(name string) (Creater, bool) {
+	creatersLocker.RLock()
+	defer creatersLocker.RUnlock()
+	c, ok := creaters[name]
+	return c, ok
+}
@@ -1,12 +1,17 @@
 package transport
 
 import (
+	"errors"
 	"io"
 	"net/http"
 
 	"github.com/webrtcn/go-socketio-client/parser"
 )
 
+//ErrPaused is returned by NextReader of a paused transport once all buffered
+//packets are read.
+var ErrPaused = errors.New("transport paused")
+
 //Callback callback function interface.
 type Callback interface {
 	OnPacket(r *parser.PacketDecoder)
@@ -16,7 +21,7 @@ type Callback interface {
 type Creater struct {
 	Name      string
 	Upgrading bool
-	Client    func(r *http.Request) (Client, error)
+	Client    func(r *http.Request, opts *Options) (Client, error)
 }
 
 // Client is a transport layer in client to connect server.
@@ -34,3 +39,17 @@ type Client interface {
 	//Close closes the transport.
 	Close() error
 }
+
+//Pauser is implemented by the transports which can be upgraded. Pause stops
+//fetching new packets, NextReader returns ErrPaused after the packets already
+//received are read.
+type Pauser interface {
+	Pause()
+}
+
+//CompressionWriter is implemented by the transports which can compress messages.
+type CompressionWriter interface {
+	//NextWriterCompress returns packet writer like NextWriter. The message is
+	//not compressed if compress is false.
+	NextWriterCompress(messageType parser.MessageType, packetType parser.PacketType, compress bool) (io.WriteCloser, error)
+}
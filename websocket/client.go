@@ -1,10 +1,10 @@
 package websocket
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gorilla/websocket"
 	"github.com/webrtcn/go-socketio-client/parser"
@@ -14,30 +14,34 @@ import (
 const (
 	protocol                = 3 //websocket version
 	eioKey                  = "EIO"
+	b64Key                  = "b64" //binary messages are sent as base64 text when set
 	transportKey            = "transport"
 	transportValue          = "websocket"
 	webSocketProtocol       = "ws"
 	webSocketSecureProtocol = "wss"
 	httpProtocol            = "http"
 	httpSecureProtocol      = "https"
-	socketio                = "socket.io/"
 )
 
 type client struct {
-	connection *websocket.Conn
-	response   *http.Response
+	connection  *websocket.Conn
+	response    *http.Response
+	version     int
+	base64      bool
+	compression bool
+	threshold   int
 }
 
-//NewClient create a new client instance.
-func NewClient(req *http.Request) (transport.Client, error) {
+//NewClient create a new client instance. opts can be nil.
+func NewClient(req *http.Request, opts *transport.Options) (transport.Client, error) {
 	switch req.URL.Scheme {
 	case httpProtocol:
 		req.URL.Scheme = webSocketProtocol
 	case httpSecureProtocol:
 		req.URL.Scheme = webSocketSecureProtocol
 	}
-	if !strings.Contains(strings.ToLower(req.URL.Path), socketio) {
-		req.URL.Path += socketio
+	if opts != nil && opts.Path != "" {
+		req.URL.Path = opts.Path
 	}
 	querys := req.URL.Query()
 	if v := querys.Get(eioKey); len(v) == 0 {
@@ -47,14 +51,51 @@ func NewClient(req *http.Request) (transport.Client, error) {
 		querys.Add(transportKey, transportValue)
 	}
 	req.URL.RawQuery = querys.Encode()
-	conn, resp, err := websocket.DefaultDialer.Dial(req.URL.String(), req.Header)
+	version, err := strconv.Atoi(querys.Get(eioKey))
 	if err != nil {
 		return nil, err
 	}
-	return &client{
+	conn, resp, err := newDialer(opts).DialContext(req.Context(), req.URL.String(), req.Header)
+	if err != nil {
+		return nil, err
+	}
+	ret := &client{
 		connection: conn,
 		response:   resp,
-	}, nil
+		version:    version,
+		base64:     querys.Get(b64Key) != "",
+	}
+	if opts != nil && opts.EnableCompression {
+		ret.compression = true
+		ret.threshold = opts.CompressionThreshold
+		if opts.CompressionLevel != 0 {
+			if err := conn.SetCompressionLevel(opts.CompressionLevel); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+func newDialer(opts *transport.Options) *websocket.Dialer {
+	if opts == nil {
+		return websocket.DefaultDialer
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = opts.TLSClientConfig
+	if opts.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = opts.HandshakeTimeout
+	}
+	dialer.ReadBufferSize = opts.ReadBufferSize
+	dialer.WriteBufferSize = opts.WriteBufferSize
+	dialer.NetDialContext = opts.NetDialContext
+	dialer.Jar = opts.Jar
+	dialer.EnableCompression = opts.EnableCompression
+	if opts.Proxy != nil {
+		dialer.Proxy = opts.Proxy
+	}
+	return &dialer
 }
 
 func (c *client) Response() *http.Response {
@@ -70,30 +111,104 @@ func (c *client) NextReader() (*parser.PacketDecoder, error) {
 		}
 		switch t {
 		case websocket.TextMessage:
-			fallthrough
+			reader = r
+			if c.version >= 4 {
+				return parser.NewDecoderV4(reader)
+			}
+			return parser.NewDecoder(reader)
 		case websocket.BinaryMessage:
 			reader = r
+			if c.version >= 4 {
+				return parser.NewRawDecoder(reader), nil
+			}
 			return parser.NewDecoder(reader)
 		}
 	}
 }
 
 func (c *client) NextWriter(msgType parser.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	return c.NextWriterCompress(msgType, packetType, true)
+}
+
+func (c *client) NextWriterCompress(msgType parser.MessageType, packetType parser.PacketType, compress bool) (io.WriteCloser, error) {
 	wsType, newEncoder := websocket.TextMessage, parser.NewStringEncoder
-	if msgType == parser.MessageBinary {
+	switch {
+	case msgType != parser.MessageBinary:
+	case c.base64 && c.version >= 4:
+		newEncoder = func(w io.Writer, t parser.PacketType) (*parser.PacketEncoder, error) {
+			return parser.NewB64EncoderV4(w)
+		}
+	case c.base64:
+		newEncoder = parser.NewB64Encoder
+	default:
 		wsType, newEncoder = websocket.BinaryMessage, parser.NewBinaryEncoder
 	}
-	w, err := c.connection.NextWriter(wsType)
-	if err != nil {
-		return nil, err
+	compress = compress && c.compression
+	var w io.WriteCloser
+	if compress && c.threshold > 0 {
+		w = &thresholdWriter{
+			client: c,
+			wsType: wsType,
+		}
+	} else {
+		c.connection.EnableWriteCompression(compress)
+		var err error
+		w, err = c.connection.NextWriter(wsType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if wsType == websocket.BinaryMessage && c.version >= 4 {
+		return parser.NewRawEncoder(w), nil
 	}
 	ret, err := newEncoder(w, packetType)
 	if err != nil {
 		return nil, err
 	}
+	if c.base64 && msgType == parser.MessageBinary {
+		return &b64Writer{
+			PacketEncoder: ret,
+			w:             w,
+		}, nil
+	}
 	return ret, nil
 }
 
 func (c *client) Close() error {
 	return c.connection.Close()
 }
+
+//b64Writer closes the base64 encoder, then the websocket message.
+type b64Writer struct {
+	*parser.PacketEncoder
+	w io.Closer
+}
+
+func (w *b64Writer) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		w.w.Close()
+		return err
+	}
+	return w.w.Close()
+}
+
+//thresholdWriter buffers the message, and compresses it only if the size
+//reaches the threshold.
+type thresholdWriter struct {
+	bytes.Buffer
+	client *client
+	wsType int
+}
+
+func (w *thresholdWriter) Close() error {
+	w.client.connection.EnableWriteCompression(w.Len() >= w.client.threshold)
+	writer, err := w.client.connection.NextWriter(w.wsType)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(w.Bytes()); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
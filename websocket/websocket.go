@@ -8,3 +8,7 @@ var Creater = transport.Creater{
 	Upgrading: true,
 	Client:    NewClient,
 }
+
+func init() {
+	transport.Register(Creater)
+}
@@ -1,11 +1,25 @@
 package websocket
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/gorilla/websocket"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/webrtcn/go-socketio-client/internal/proxytest"
+	"github.com/webrtcn/go-socketio-client/parser"
+	"github.com/webrtcn/go-socketio-client/transport"
 )
 
 func TestWebsocket(t *testing.T) {
@@ -22,7 +36,7 @@ func TestWebsocket(t *testing.T) {
 		req, err := http.NewRequest("GET", u.String(), nil)
 		So(err, ShouldBeNil)
 		So(req.URL.String(), ShouldEqual, "ws://localhost:5000")
-		c, err := NewClient(req)
+		c, err := NewClient(req, nil)
 		So(err, ShouldBeNil)
 		defer c.Close()
 		// So(c.Response(), ShouldNotBeNil)
@@ -50,3 +64,310 @@ func TestWebsocket(t *testing.T) {
 		// c.Close()
 	})
 }
+
+func TestWebsocketTLS(t *testing.T) {
+	Convey("Dial with custom root CAs", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		_, err = NewClient(req, nil)
+		So(err, ShouldNotBeNil)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		dialed := false
+		opts := &transport.Options{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = true
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+		req, err = http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, opts)
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(dialed, ShouldBeTrue)
+		decoder, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.MESSAGE)
+	})
+}
+
+func TestWebsocketProxy(t *testing.T) {
+	Convey("Dial through http CONNECT proxy with basic auth", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+		auth := make(chan string, 1)
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth <- r.Header.Get("Proxy-Authorization")
+			if r.Method != "CONNECT" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			dst, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer dst.Close()
+			w.WriteHeader(http.StatusOK)
+			src, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer src.Close()
+			go io.Copy(dst, src)
+			io.Copy(src, dst)
+		}))
+		defer proxy.Close()
+
+		proxyURL, err := url.Parse(proxy.URL)
+		So(err, ShouldBeNil)
+		proxyURL.User = url.UserPassword("user", "pass")
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, &transport.Options{Proxy: http.ProxyURL(proxyURL)})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(<-auth, ShouldEqual, "Basic dXNlcjpwYXNz")
+		decoder, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.MESSAGE)
+	})
+}
+
+func TestWebsocketSOCKS5(t *testing.T) {
+	Convey("Dial through socks5 proxy", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+			ws.ReadMessage()
+		}))
+		defer server.Close()
+		proxy := proxytest.NewSOCKS5()
+		defer proxy.Close()
+
+		serverURL, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, &transport.Options{Proxy: http.ProxyURL(proxy.URL)})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(proxy.Hosts(), ShouldResemble, []string{serverURL.Host})
+		decoder, err := c.NextReader()
+		So(err, ShouldBeNil)
+		So(decoder.Type(), ShouldEqual, parser.MESSAGE)
+	})
+}
+
+//envProxy and envSecureProxy are HTTP_PROXY and HTTPS_PROXY of the tests,
+//set by TestMain before http.ProxyFromEnvironment reads them once.
+var envProxy, envSecureProxy *proxytest.Proxy
+
+func TestMain(m *testing.M) {
+	envProxy = proxytest.NewHTTP()
+	envSecureProxy = proxytest.NewHTTP()
+	os.Setenv("HTTP_PROXY", envProxy.URL.String())
+	os.Setenv("HTTPS_PROXY", envSecureProxy.URL.String())
+	os.Setenv("NO_PROXY", "bypass.test")
+	code := m.Run()
+	envProxy.Close()
+	envSecureProxy.Close()
+	os.Exit(code)
+}
+
+func TestWebsocketEnvironmentProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+		ws.ReadMessage()
+	})
+	dial := func(rawurl string, opts *transport.Options) error {
+		req, err := http.NewRequest("GET", rawurl, nil)
+		if err != nil {
+			return err
+		}
+		c, err := NewClient(req, opts)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		_, err = c.NextReader()
+		return err
+	}
+
+	Convey("Dial ws through HTTP_PROXY", t, func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		envProxy.SetTarget(server.Listener.Addr().String())
+		So(dial("http://engine.test/", nil), ShouldBeNil)
+		So(envProxy.Hosts(), ShouldContain, "engine.test:80")
+	})
+
+	Convey("Dial wss through HTTPS_PROXY", t, func() {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+		envSecureProxy.SetTarget(server.Listener.Addr().String())
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		opts := &transport.Options{
+			TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "example.com"},
+		}
+		So(dial("https://engine.test/", opts), ShouldBeNil)
+		So(envSecureProxy.Hosts(), ShouldContain, "engine.test:443")
+	})
+
+	Convey("Dial hosts of NO_PROXY directly", t, func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		proxied := len(envProxy.Hosts())
+		opts := &transport.Options{
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		}
+		So(dial("http://bypass.test/", opts), ShouldBeNil)
+		So(len(envProxy.Hosts()), ShouldEqual, proxied)
+	})
+}
+
+type countConn struct {
+	net.Conn
+	written *int64
+}
+
+func (c countConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(c.written, int64(len(p)))
+	return c.Conn.Write(p)
+}
+
+func TestWebsocketCompression(t *testing.T) {
+	Convey("Compress messages reach the threshold", t, func() {
+		received := make(chan string, 3)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := (&websocket.Upgrader{EnableCompression: true}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			for {
+				_, b, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				received <- string(b)
+			}
+		}))
+		defer server.Close()
+
+		var written int64
+		opts := &transport.Options{
+			EnableCompression:    true,
+			CompressionThreshold: 1024,
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				return countConn{conn, &written}, err
+			},
+		}
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		c, err := NewClient(req, opts)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		send := func(data string, compress bool) int64 {
+			before := atomic.LoadInt64(&written)
+			w, err := c.(transport.CompressionWriter).NextWriterCompress(parser.MessageText, parser.MESSAGE, compress)
+			So(err, ShouldBeNil)
+			w.Write([]byte(data))
+			So(w.Close(), ShouldBeNil)
+			So(<-received, ShouldEqual, "4"+data)
+			return atomic.LoadInt64(&written) - before
+		}
+		large := strings.Repeat("abcdefgh", 1024)
+		So(send(large, true), ShouldBeLessThan, 1024)
+		So(send(large, false), ShouldBeGreaterThan, len(large))
+		small := strings.Repeat("a", 100)
+		So(send(small, true), ShouldBeGreaterThan, len(small))
+	})
+}
+
+func TestWebsocketBase64(t *testing.T) {
+	for _, version := range []string{"3", "4"} {
+		Convey("Base64 binary messages, engine.io v"+version, t, func() {
+			received := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer ws.Close()
+				if version == "3" {
+					ws.WriteMessage(websocket.TextMessage, []byte("b4AQI="))
+				} else {
+					ws.WriteMessage(websocket.TextMessage, []byte("bAQI="))
+				}
+				msgType, b, err := ws.ReadMessage()
+				if err != nil || msgType != websocket.TextMessage {
+					received <- "unexpected message"
+					return
+				}
+				received <- string(b)
+				ws.ReadMessage()
+			}))
+			defer server.Close()
+
+			req, err := http.NewRequest("GET", server.URL+"/?b64=1&EIO="+version, nil)
+			So(err, ShouldBeNil)
+			c, err := NewClient(req, nil)
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			decoder, err := c.NextReader()
+			So(err, ShouldBeNil)
+			So(decoder.MessageType(), ShouldEqual, parser.MessageBinary)
+			b, err := ioutil.ReadAll(decoder)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte{1, 2})
+
+			w, err := c.NextWriter(parser.MessageBinary, parser.MESSAGE)
+			So(err, ShouldBeNil)
+			w.Write([]byte{3, 4})
+			So(w.Close(), ShouldBeNil)
+			if version == "3" {
+				So(<-received, ShouldEqual, "b4AwQ=")
+			} else {
+				So(<-received, ShouldEqual, "bAwQ=")
+			}
+		})
+	}
+}